@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/nlopes/slack"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/store"
+)
+
+const blockedUsage = "/blocked <what blocks you>"
+
+// Handle `/blocked`, the blocker is posted as other items and pings the
+// leads of its tags
+func blocked(items store.ItemStore, settings *liveConfig) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		handleCommand(c, items, store.KindBlocked, c.PostForm("text"), settings.Load(), blockedUsage)
+	}
+}
+
+// Handle `/unblocked [<id|last>]`, without an id it is the latest open
+// blocker of the user
+func unblocked(items store.ItemStore, settings *liveConfig) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ref := strings.TrimSpace(c.PostForm("text"))
+		message, err := resolveBlocker(items, settings.Load(), c.PostForm("user_id"), c.PostForm("user_name"), ref)
+		respondCommand(c, message, err)
+	}
+}
+
+// Resolve a blocked item and update its posts, which lose their resolve
+// button. Anyone may resolve a blocker, not only its author.
+func resolveBlocker(items store.ItemStore, config Configuration, userID, userName, ref string) (string, error) {
+	item, err := findBlocker(items, userID, ref)
+	if err != nil {
+		return "", err
+	}
+
+	if !item.Blocking() {
+		return "", commandError(fmt.Sprintf("`%s` is resolved already.", item.ID.Hex()))
+	}
+
+	item.Resolved = &store.Resolution{UserID: userID, Name: userName, At: time.Now()}
+	if err := items.Update(item, "resolved"); err != nil {
+		return "", err
+	}
+
+	for _, post := range item.Posts {
+		err := withPoster(config, post, func(token string, templates *render.Set) error {
+			title, err := templates.Render(item.Kind, itemData(config, item))
+			if err != nil {
+				return err
+			}
+
+			return bot.Replace(token, post, title, itemAttachments(item))
+		})
+		if err != nil {
+			log.Errorf("Cannot update post of item %s in %s: %s", item.ID.Hex(), post.Route, err)
+		}
+	}
+
+	return fmt.Sprintf("Resolved `%s` after %s :white_check_mark:",
+		item.ID.Hex(), render.Duration(item.Resolved.At.Sub(item.CreatedAt))), nil
+}
+
+// Find a blocked item by id, or the latest open one of the user for "last"
+// or nothing
+func findBlocker(items store.ItemStore, userID, ref string) (*store.Item, error) {
+	switch {
+	case ref == "" || ref == "last":
+		open, err := items.ListBlocking()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i].UserID == userID {
+				return &open[i], nil
+			}
+		}
+
+		return nil, commandError("You have no open blocker to resolve.")
+	case !bson.IsObjectIdHex(ref):
+		return nil, commandError(fmt.Sprintf("`%s` is not an entry id, use the id I gave you or `last`", ref))
+	}
+
+	item, err := items.Get(bson.ObjectIdHex(ref))
+	if err == store.ErrNotFound {
+		return nil, commandError("I couldn't find that entry.")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Kind != store.KindBlocked {
+		return nil, commandError(fmt.Sprintf("`%s` is not a blocker.", ref))
+	}
+
+	return item, nil
+}
+
+// Leads of the tags of the item, in the order of its tags and without repeats
+func leadsOf(config Configuration, item *store.Item) []string {
+	var leads []string
+	seen := map[string]bool{}
+
+	for _, tag := range item.Entities.Tags {
+		for leadTag, lead := range config.Leads {
+			if store.NormalizeTag(leadTag) == tag && !seen[lead] {
+				seen[lead] = true
+				leads = append(leads, lead)
+			}
+		}
+	}
+
+	return leads
+}
+
+// Button under the posts of an open blocker to resolve it
+func blockerAttachments(item *store.Item) []slack.Attachment {
+	return []slack.Attachment{
+		slack.Attachment{
+			Fallback:   "Use /unblocked to resolve this blocker",
+			CallbackID: "blocker",
+			Actions: []slack.AttachmentAction{
+				slack.AttachmentAction{Name: "resolve", Text: "Resolve", Type: "button", Style: "primary", Value: item.ID.Hex()},
+			},
+		},
+	}
+}
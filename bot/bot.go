@@ -0,0 +1,316 @@
+// Package bot posts and changes the messages of the bot, and records them
+// so they can be found again later.
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+const (
+	Username = "oshin"
+	IconURL  = "http://i.imgur.com/fLcxkel.png"
+)
+
+// Identity of a token, the team and the bot user it posts as
+type Identity struct {
+	TeamID string
+	UserID string
+
+	// URL of the team, e.g. https://dwarves.slack.com/
+	URL string
+}
+
+var (
+	identityMu sync.Mutex
+	identities = map[string]*Identity{}
+)
+
+// IdentityOf asks Slack who the token is, the answer is cached
+func IdentityOf(token string) (*Identity, error) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+
+	if identity, ok := identities[token]; ok {
+		return identity, nil
+	}
+
+	res, err := slack.New(token).AuthTest()
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{TeamID: res.TeamID, UserID: res.UserID, URL: res.URL}
+	identities[token] = identity
+
+	return identity, nil
+}
+
+// Owns tells if the token posted the post.
+// Posts recorded before identities were stored are owned by nobody.
+func (i *Identity) Owns(post store.Post) bool {
+	return post.Team != "" && post.Team == i.TeamID && post.Bot == i.UserID
+}
+
+// Permalink of a message, built the way Slack builds them
+func Permalink(teamURL, channel, ts string) string {
+	if teamURL == "" || channel == "" || ts == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%sarchives/%s/p%s", strings.TrimSuffix(teamURL, "/")+"/", channel, strings.Replace(ts, ".", "", 1))
+}
+
+// Post text to the channel and return the record of the post
+func Post(token, channel, text string, attachments []slack.Attachment) (store.Post, error) {
+	return post(token, channel, channel, text, "", attachments)
+}
+
+// Reply posts text in the thread of a post
+func Reply(token string, parent store.Post, text string) (store.Post, error) {
+	thread := parent.Thread
+	if thread == "" {
+		thread = parent.Timestamp
+	}
+
+	return post(token, parent.Route, parent.Channel, text, thread, nil)
+}
+
+func post(token, route, channel, text, thread string, attachments []slack.Attachment) (store.Post, error) {
+	values := url.Values{
+		"channel":  {channel},
+		"text":     {text},
+		"username": {Username},
+		"icon_url": {IconURL},
+	}
+
+	if thread != "" {
+		values.Set("thread_ts", thread)
+	}
+
+	if attachments != nil {
+		encoded, err := json.Marshal(attachments)
+		if err != nil {
+			return store.Post{}, err
+		}
+		values.Set("attachments", string(encoded))
+	}
+
+	res, err := call(token, "chat.postMessage", values)
+	if err != nil {
+		return store.Post{}, err
+	}
+
+	p := store.Post{Route: route, Channel: res.Channel, Timestamp: res.Timestamp, Thread: thread}
+
+	// The post is done already, without identity it just can't be found by token later
+	if identity, err := IdentityOf(token); err == nil {
+		p.Team = identity.TeamID
+		p.Bot = identity.UserID
+		p.Permalink = Permalink(identity.URL, res.Channel, res.Timestamp)
+	}
+
+	return p, nil
+}
+
+// Ephemeral posts text to the channel that only the user sees, it is not recorded
+func Ephemeral(token, channel, user, text string) error {
+	_, err := call(token, "chat.postEphemeral", url.Values{
+		"channel": {channel},
+		"user":    {user},
+		"text":    {text},
+	})
+
+	return err
+}
+
+// Message returns the message of the channel posted at ts, in the channel
+// or in a thread
+func Message(token, channel, ts string) (*slack.Msg, error) {
+	msg, err := findMessage(token, "conversations.history", url.Values{
+		"channel":   {channel},
+		"latest":    {ts},
+		"inclusive": {"true"},
+		"limit":     {"1"},
+	}, ts)
+	if err != nil || msg != nil {
+		return msg, err
+	}
+
+	// Replies in threads are not in the history of the channel. The parent
+	// comes first, then the replies from oldest.
+	msg, err = findMessage(token, "conversations.replies", url.Values{
+		"channel":   {channel},
+		"ts":        {ts},
+		"oldest":    {ts},
+		"inclusive": {"true"},
+	}, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg == nil {
+		return nil, fmt.Errorf("No message at %s in %s", ts, channel)
+	}
+
+	return msg, nil
+}
+
+// The message posted at ts of the ones the method returns, nil if it is
+// not one of them
+func findMessage(token, method string, values url.Values, ts string) (*slack.Msg, error) {
+	var res struct {
+		Messages []slack.Msg `json:"messages"`
+	}
+
+	if err := callInto(token, method, values, &res); err != nil {
+		return nil, err
+	}
+
+	for i := range res.Messages {
+		if res.Messages[i].Timestamp == ts {
+			return &res.Messages[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// OpenDialog opens a dialog for the user whose interaction gave the trigger
+func OpenDialog(token, triggerID string, dialog interface{}) error {
+	encoded, err := json.Marshal(dialog)
+	if err != nil {
+		return err
+	}
+
+	_, err = call(token, "dialog.open", url.Values{
+		"trigger_id": {triggerID},
+		"dialog":     {string(encoded)},
+	})
+
+	return err
+}
+
+// Respond sends a message only the user sees to the response URL of their
+// interaction
+func Respond(responseURL, text string) error {
+	encoded, err := json.Marshal(map[string]string{"response_type": "ephemeral", "text": text})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Response URL answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Update replaces the text of a post
+func Update(token string, p store.Post, text string) error {
+	_, err := call(token, "chat.update", url.Values{
+		"channel": {p.Channel},
+		"ts":      {p.Timestamp},
+		"text":    {text},
+	})
+
+	return err
+}
+
+// Replace replaces the text and the attachments of a post, no attachments
+// removes the ones it has. Update keeps them.
+func Replace(token string, p store.Post, text string, attachments []slack.Attachment) error {
+	if attachments == nil {
+		attachments = []slack.Attachment{}
+	}
+
+	encoded, err := json.Marshal(attachments)
+	if err != nil {
+		return err
+	}
+
+	_, err = call(token, "chat.update", url.Values{
+		"channel":     {p.Channel},
+		"ts":          {p.Timestamp},
+		"text":        {text},
+		"attachments": {string(encoded)},
+	})
+
+	return err
+}
+
+// Delete removes a post
+func Delete(token string, p store.Post) error {
+	_, _, err := slack.New(token).DeleteMessage(p.Channel, p.Timestamp)
+	return err
+}
+
+// React adds an emoji reaction to a post
+func React(token string, p store.Post, emoji string) error {
+	return slack.New(token).AddReaction(emoji, slack.NewRefToMessage(p.Channel, p.Timestamp))
+}
+
+type response struct {
+	slack.SlackResponse
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Call a chat method of the Web API directly, for the parameters the
+// vendored client does not support
+func call(token, method string, values url.Values) (*response, error) {
+	var res response
+	if err := callInto(token, method, values, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Call a method of the Web API and decode its response into v
+func callInto(token, method string, values url.Values, v interface{}) error {
+	values.Set("token", token)
+
+	resp, err := client.PostForm(slack.SLACK_API+method, values)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var res slack.SlackResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return err
+	}
+
+	if !res.Ok {
+		return errors.New(res.Error)
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,212 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Format of days in ranges, holidays and leave. Days in this format compare
+// as strings.
+const Day = "2006-01-02"
+
+// Holiday is a range of days, both ends included
+type Holiday struct {
+	Name string
+	From string
+	To   string
+}
+
+// Calendar holds the holidays of a team. A nil calendar has no holidays.
+type Calendar struct {
+	Holidays []Holiday
+}
+
+// Load reads holidays from iCalendar files
+func Load(paths ...string) (*Calendar, error) {
+	c := &Calendar{}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read holidays from %s", path)
+		}
+
+		holidays, err := ParseICS(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse holidays of %s: %s", path, err)
+		}
+
+		c.Holidays = append(c.Holidays, holidays...)
+	}
+
+	return c, nil
+}
+
+// Merge returns a calendar with the holidays of both calendars
+func (c *Calendar) Merge(other *Calendar) *Calendar {
+	merged := &Calendar{}
+
+	for _, cal := range []*Calendar{c, other} {
+		if cal != nil {
+			merged.Holidays = append(merged.Holidays, cal.Holidays...)
+		}
+	}
+
+	return merged
+}
+
+// Holiday returns the holiday on the day of at, in the location of at
+func (c *Calendar) Holiday(at time.Time) (Holiday, bool) {
+	if c == nil {
+		return Holiday{}, false
+	}
+
+	day := at.Format(Day)
+	for _, h := range c.Holidays {
+		if h.From <= day && day <= h.To {
+			return h, true
+		}
+	}
+
+	return Holiday{}, false
+}
+
+// IsHoliday tells if the day of at, in the location of at, is a holiday
+func (c *Calendar) IsHoliday(at time.Time) bool {
+	_, ok := c.Holiday(at)
+	return ok
+}
+
+// ParseRange parses a "2006-01-02" day or a "2006-01-02..2006-01-05" range
+func ParseRange(s string) (string, string, error) {
+	bounds := strings.SplitN(strings.TrimSpace(s), "..", 2)
+	if len(bounds) == 1 {
+		bounds = append(bounds, bounds[0])
+	}
+
+	for _, bound := range bounds {
+		if _, err := time.Parse(Day, bound); err != nil {
+			return "", "", fmt.Errorf("Invalid date %q, expected YYYY-MM-DD", bound)
+		}
+	}
+
+	if bounds[1] < bounds[0] {
+		return "", "", fmt.Errorf("Invalid range %q, it ends before it starts", s)
+	}
+
+	return bounds[0], bounds[1], nil
+}
+
+// ParseICS reads the events of an iCalendar file as holidays.
+// All-day events end the day before DTEND, as the standard says, timed
+// events on the day of DTEND, in UTC or the local time they are written in. Recurring events are not expanded.
+func ParseICS(r io.Reader) ([]Holiday, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays []Holiday
+	var event *Holiday
+	var endExclusive bool
+
+	for i, line := range lines {
+		name, value := property(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &Holiday{}
+			endExclusive = false
+		case event == nil:
+			continue
+		case name == "SUMMARY":
+			event.Name = unescape(value)
+		case name == "DTSTART":
+			event.From, err = icsDay(value)
+		case name == "DTEND":
+			event.To, err = icsDay(value)
+			endExclusive = len(value) == 8
+		case name == "END" && value == "VEVENT":
+			if event.From == "" {
+				return nil, fmt.Errorf("Event %q without DTSTART", event.Name)
+			}
+
+			if event.To == "" {
+				event.To = event.From
+			} else if endExclusive {
+				end, _ := time.Parse(Day, event.To)
+				event.To = end.AddDate(0, 0, -1).Format(Day)
+			}
+
+			if event.To < event.From {
+				event.To = event.From
+			}
+
+			holidays = append(holidays, *event)
+			event = nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+	}
+
+	return holidays, nil
+}
+
+// Lines of the file, long lines are folded with a leading space or tab
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// Split "NAME;PARAM=X:value" into its name and value, params are ignored
+func property(line string) (string, string) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return strings.ToUpper(line), ""
+	}
+
+	name, value := line[:i], line[i+1:]
+	if j := strings.Index(name, ";"); j >= 0 {
+		name = name[:j]
+	}
+
+	return strings.ToUpper(name), value
+}
+
+// Day of a DATE "20261020" or DATE-TIME "20261020T090000Z" value
+func icsDay(value string) (string, error) {
+	if len(value) < 8 {
+		return "", fmt.Errorf("Invalid date %q", value)
+	}
+
+	day, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return "", fmt.Errorf("Invalid date %q", value)
+	}
+
+	return day.Format(Day), nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(s)
+}
@@ -0,0 +1,103 @@
+package calendar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseICS(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		holidays []Holiday
+	}{
+		{
+			"all-day event ends the day before DTEND",
+			"SUMMARY:Tet\r\nDTSTART;VALUE=DATE:20270205\r\nDTEND;VALUE=DATE:20270210\r\n",
+			[]Holiday{{Name: "Tet", From: "2027-02-05", To: "2027-02-09"}},
+		},
+		{
+			"one all-day event",
+			"SUMMARY:National Day\nDTSTART;VALUE=DATE:20260902\nDTEND;VALUE=DATE:20260903\n",
+			[]Holiday{{Name: "National Day", From: "2026-09-02", To: "2026-09-02"}},
+		},
+		{
+			"all-day event without DTEND",
+			"SUMMARY:Company trip\nDTSTART;VALUE=DATE:20261120\n",
+			[]Holiday{{Name: "Company trip", From: "2026-11-20", To: "2026-11-20"}},
+		},
+		{
+			"all-day event with DTEND on DTSTART",
+			"SUMMARY:Half day\nDTSTART;VALUE=DATE:20261224\nDTEND;VALUE=DATE:20261224\n",
+			[]Holiday{{Name: "Half day", From: "2026-12-24", To: "2026-12-24"}},
+		},
+		{
+			"timed event ends on the day of DTEND",
+			"SUMMARY:Offsite\nDTSTART:20261020T090000Z\nDTEND:20261021T170000Z\n",
+			[]Holiday{{Name: "Offsite", From: "2026-10-20", To: "2026-10-21"}},
+		},
+		{
+			"timed event in local time",
+			"SUMMARY:Party\nDTSTART;TZID=Asia/Ho_Chi_Minh:20261231T180000\nDTEND;TZID=Asia/Ho_Chi_Minh:20261231T230000\n",
+			[]Holiday{{Name: "Party", From: "2026-12-31", To: "2026-12-31"}},
+		},
+		{
+			"folded and escaped summary",
+			"SUMMARY:Reunification Day\\, Labour\n  Day\nDTSTART;VALUE=DATE:20260430\nDTEND;VALUE=DATE:20260502\n",
+			[]Holiday{{Name: "Reunification Day, Labour Day", From: "2026-04-30", To: "2026-05-01"}},
+		},
+	}
+
+	for _, test := range tests {
+		ics := "BEGIN:VCALENDAR\nBEGIN:VEVENT\n" + test.event + "END:VEVENT\nEND:VCALENDAR\n"
+
+		holidays, err := ParseICS(strings.NewReader(ics))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(holidays, test.holidays) {
+			t.Errorf("%s: got %+v, want %+v", test.name, holidays, test.holidays)
+		}
+	}
+}
+
+func TestParseICSErrors(t *testing.T) {
+	tests := []struct {
+		ics string
+		err string
+	}{
+		{"BEGIN:VEVENT\nSUMMARY:Tet\nEND:VEVENT\n", `Event "Tet" without DTSTART`},
+		{"BEGIN:VEVENT\nSUMMARY:Tet\nDTSTART;VALUE=DATE:2027020\nEND:VEVENT\n", `line 3: Invalid date "2027020"`},
+		{"BEGIN:VEVENT\nDTSTART;VALUE=DATE:20270205\nDTEND;VALUE=DATE:20271305\nEND:VEVENT\n", `line 3: Invalid date "20271305"`},
+	}
+
+	for _, test := range tests {
+		_, err := ParseICS(strings.NewReader(test.ics))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("ParseICS(%q): got %v, want %s", test.ics, err, test.err)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		s, from, to string
+		ok          bool
+	}{
+		{"2026-10-20", "2026-10-20", "2026-10-20", true},
+		{"2026-10-20..2026-10-24", "2026-10-20", "2026-10-24", true},
+		{"2026-10-24..2026-10-20", "", "", false},
+		{"2026-10-20..", "", "", false},
+		{"tomorrow", "", "", false},
+	}
+
+	for _, test := range tests {
+		from, to, err := ParseRange(test.s)
+		if (err == nil) != test.ok || from != test.from || to != test.to {
+			t.Errorf("ParseRange(%q) = %q, %q, %v", test.s, from, to, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Command migrate-items copies the items, users and reminders collections of
+// MongoDB into the SQL database of DATABASE_URL. Documents which are copied
+// already are skipped, so it is safe to run it again.
+package main
+
+import (
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func main() {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatalln("No DATABASE_URL provided")
+	}
+
+	target, err := store.NewSQLStore(databaseURL)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	defer target.Close()
+
+	source, err := store.NewMongoStore()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	defer source.Close()
+
+	copied, skipped := 0, 0
+	err = source.Each(func(item store.Item) error {
+		_, err := target.Get(item.ID)
+		if err == nil {
+			skipped++
+			return nil
+		}
+		if err != store.ErrNotFound {
+			return err
+		}
+
+		if item.Kind == "" {
+			item.Kind = store.GuessKind(item.Text)
+		}
+
+		// Parse entities again, old items have none
+		item.SetText(item.Text)
+
+		if err := target.Insert(&item); err != nil {
+			return err
+		}
+
+		copied++
+		return nil
+	})
+
+	if err != nil {
+		log.Fatalf("Stopped after copying %d items: %s", copied, err)
+	}
+
+	log.Infof("Copied %d items, skipped %d items already in SQL", copied, skipped)
+
+	copied, skipped, err = copyUsers(source, target)
+	if err != nil {
+		log.Fatalf("Stopped after copying %d users: %s", copied, err)
+	}
+
+	log.Infof("Copied %d users, skipped %d users already in SQL", copied, skipped)
+
+	copied, skipped, err = copyReminders(source, target)
+	if err != nil {
+		log.Fatalf("Stopped after copying %d reminders: %s", copied, err)
+	}
+
+	log.Infof("Copied %d reminders, skipped %d reminders already in SQL", copied, skipped)
+}
+
+// Copy nudge opt-outs and leave. Users who have preferences in SQL already
+// may have changed them since, they are kept.
+func copyUsers(source *store.MongoStore, target *store.SQLStore) (int, int, error) {
+	copied, skipped := 0, 0
+
+	err := source.EachUser(func(user store.User) error {
+		stored, err := target.GetUser(user.ID)
+		if err != nil {
+			return err
+		}
+
+		if stored.Name != "" || stored.NoNudge || len(stored.Leaves) > 0 {
+			skipped++
+			return nil
+		}
+
+		if err := target.SaveUser(&user); err != nil {
+			return err
+		}
+
+		copied++
+		return nil
+	})
+
+	return copied, skipped, err
+}
+
+// Copy the reminders added with `/working remind add`
+func copyReminders(source *store.MongoStore, target *store.SQLStore) (int, int, error) {
+	reminders, err := source.ListReminders()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	existing, err := target.ListReminders()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stored := map[string]bool{}
+	for _, reminder := range existing {
+		stored[reminder.ID.Hex()] = true
+	}
+
+	copied, skipped := 0, 0
+	for _, reminder := range reminders {
+		if stored[reminder.ID.Hex()] {
+			skipped++
+			continue
+		}
+
+		if err := target.InsertReminder(&reminder); err != nil {
+			return copied, skipped, err
+		}
+
+		copied++
+	}
+
+	return copied, skipped, nil
+}
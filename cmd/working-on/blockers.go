@@ -0,0 +1 @@
+../../blockers.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../commands.go
\ No newline at end of file
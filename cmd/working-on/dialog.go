@@ -0,0 +1 @@
+../../dialog.go
\ No newline at end of file
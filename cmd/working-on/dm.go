@@ -0,0 +1 @@
+../../dm.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../events.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../jobs.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../leave.go
\ No newline at end of file
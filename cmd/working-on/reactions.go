@@ -0,0 +1 @@
+../../reactions.go
\ No newline at end of file
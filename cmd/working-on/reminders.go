@@ -0,0 +1 @@
+../../reminders.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../search.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../tasks.go
\ No newline at end of file
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/nlopes/slack"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/remind"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/store"
+)
+
+const workingUsage = "/working <what you are going to do>`, `/working edit <id|last> <new text>`, `/working delete <id|last>`, `/working nudge <on|off>`, `/working remind <add|list|remove>`, `/working search <words>` or `/working off <YYYY-MM-DD>[..<YYYY-MM-DD>]"
+
+// Error to be shown to the user who issued a command
+type commandError string
+
+func (e commandError) Error() string {
+	return string(e)
+}
+
+// Text of the reply to the user: the message, or the error if any.
+// Unexpected errors are logged and only a generic message is shown.
+func replyText(message string, err error, context string) string {
+	if e, ok := err.(commandError); ok {
+		log.Infof("%s: %s", context, e)
+		return string(e)
+	}
+
+	if err != nil {
+		log.Errorf("%s: %s", context, err)
+		return "Sorry, something went wrong. Please try again in a moment."
+	}
+
+	return message
+}
+
+// Handle `/working`, plain text is a working item, the first word may be a subcommand
+func working(items store.Store, settings *liveConfig, reminders *remind.Runner, jobs *digestJobs) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		config := settings.Load()
+		text := strings.TrimSpace(c.PostForm("text"))
+		userID := c.PostForm("user_id")
+
+		// Without text, a dialog for a structured entry. The usage is shown
+		// when it cannot open.
+		if text == "" && c.PostForm("trigger_id") != "" {
+			err := openEntryDialog(c, config)
+			if err == nil {
+				c.Status(http.StatusOK)
+				return
+			}
+			log.Errorf("Cannot open entry dialog: %s", err)
+		}
+
+		command, args := splitCommand(text)
+		if !isSubcommand(command, args) {
+			command = ""
+		}
+
+		switch command {
+		case "edit":
+			ref, newText := splitCommand(args)
+			message, err := editItem(items, config, userID, ref, newText)
+			respondCommand(c, message, err)
+		case "delete":
+			message, err := deleteItem(items, config, userID, args)
+			respondCommand(c, message, err)
+		case "nudge":
+			message, err := setNudge(items, userID, c.PostForm("user_name"), args)
+			respondCommand(c, message, err)
+		case "remind":
+			message, err := remindCommand(items, reminders, userID, args)
+			respondCommand(c, message, err)
+		case "off":
+			message, err := setLeave(items, userID, c.PostForm("user_name"), args)
+			respondCommand(c, message, err)
+		case "search":
+			message, attachments, err := searchItems(items, args, 1, jobs.Location())
+			if err != nil {
+				respondCommand(c, "", err)
+				return
+			}
+			c.JSON(http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: message, Attachments: attachments})
+		default:
+			handleCommand(c, items, store.KindWorking, text, config, workingUsage)
+		}
+	}
+}
+
+// Whether the first word of the text is a subcommand rather than the start
+// of an entry, so "edit the onboarding docs" is saved as it is. Without
+// arguments the subcommands show their usage.
+func isSubcommand(command, args string) bool {
+	first, _ := splitCommand(args)
+	if args == "" {
+		switch command {
+		case "edit", "delete", "nudge", "remind", "off", "search":
+			return true
+		}
+		return false
+	}
+
+	switch command {
+	case "edit":
+		return isItemRef(first)
+	case "delete":
+		return isItemRef(args)
+	case "nudge":
+		return strings.EqualFold(args, "on") || strings.EqualFold(args, "off")
+	case "remind":
+		return first == "add" || first == "list" || first == "remove"
+	case "off":
+		// Mistyped dates still get an error instead of an entry
+		return first == "cancel" || leaveArgs.MatchString(args)
+	case "search":
+		_, err := parseSearch(args, time.UTC)
+		return err == nil
+	}
+
+	return false
+}
+
+// Arguments of `/working off` which look like a day or a range of days
+var leaveArgs = regexp.MustCompile(`^\d{4}-\d`)
+
+// Whether the text refers to an item, by id or "last"
+func isItemRef(ref string) bool {
+	return ref == "last" || bson.IsObjectIdHex(ref)
+}
+
+// Split the first word from the rest of the text
+func splitCommand(text string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(text), " ", 2)
+	if len(parts) < 2 {
+		return strings.ToLower(parts[0]), ""
+	}
+
+	return strings.ToLower(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// Reply with the message, or with the error if any
+func respondCommand(c *gin.Context, message string, err error) {
+	respondEphemeral(c, replyText(message, err, "Cannot handle "+c.Request.URL.Path))
+}
+
+// Turn direct messages about not posting today on or off for the user
+func setNudge(users store.UserStore, userID, userName, value string) (string, error) {
+	var off bool
+	switch strings.ToLower(value) {
+	case "on":
+	case "off":
+		off = true
+	default:
+		return "", commandError("Usage: `/working nudge <on|off>`")
+	}
+
+	user, err := users.GetUser(userID)
+	if err != nil {
+		return "", err
+	}
+
+	user.Name = userName
+	user.NoNudge = off
+	if err := users.SaveUser(user); err != nil {
+		return "", err
+	}
+
+	if off {
+		return "OK, no more reminders when you have not posted anything for the day.", nil
+	}
+
+	return "OK, you will get a reminder when you have not posted anything for the day.", nil
+}
+
+func editItem(items store.ItemStore, config Configuration, userID, ref, text string) (string, error) {
+	if ref == "" || text == "" {
+		return "", commandError("Usage: `/working edit <id|last> <new text>`")
+	}
+
+	item, err := findOwnItem(items, userID, ref)
+	if err != nil {
+		return "", err
+	}
+
+	item.SetText(text)
+	return updateItem(items, config, item)
+}
+
+// Save a changed item and update its posts
+func updateItem(items store.ItemStore, config Configuration, item *store.Item) (string, error) {
+	if err := items.Update(item, "text", "entities", "estimate", "blockers"); err != nil {
+		return "", err
+	}
+
+	for _, post := range item.Posts {
+		err := withPoster(config, post, func(token string, templates *render.Set) error {
+			title, err := templates.Render(item.Kind, itemData(config, item))
+			if err != nil {
+				return err
+			}
+
+			return bot.Update(token, post, title)
+		})
+		if err != nil {
+			log.Errorf("Cannot update post of item %s in %s: %s", item.ID.Hex(), post.Route, err)
+		}
+	}
+
+	return fmt.Sprintf("Updated `%s` :pencil2:", item.ID.Hex()), nil
+}
+
+func deleteItem(items store.ItemStore, config Configuration, userID, ref string) (string, error) {
+	if ref == "" {
+		return "", commandError("Usage: `/working delete <id|last>`")
+	}
+
+	item, err := findOwnItem(items, userID, ref)
+	if err != nil {
+		return "", err
+	}
+
+	// The working item of a deleted done item is open again
+	if err := unlinkTask(items, item); err != nil {
+		return "", err
+	}
+
+	if err := items.Delete(item.ID); err != nil {
+		return "", err
+	}
+
+	for _, post := range item.Posts {
+		err := withPoster(config, post, func(token string, templates *render.Set) error {
+			return bot.Delete(token, post)
+		})
+		if err != nil {
+			log.Errorf("Cannot delete post of item %s in %s: %s", item.ID.Hex(), post.Route, err)
+		}
+	}
+
+	return fmt.Sprintf("Deleted `%s` :wastebasket:", item.ID.Hex()), nil
+}
+
+// Find an item by id or "last", only its author can get it
+func findOwnItem(items store.ItemStore, userID, ref string) (*store.Item, error) {
+	var item *store.Item
+	var err error
+
+	switch {
+	case ref == "last":
+		item, err = items.Latest(userID)
+	case bson.IsObjectIdHex(ref):
+		item, err = items.Get(bson.ObjectIdHex(ref))
+	default:
+		return nil, commandError(fmt.Sprintf("`%s` is not an entry id, use the id I gave you or `last`", ref))
+	}
+
+	if err == store.ErrNotFound {
+		return nil, commandError("I couldn't find that entry.")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if item.UserID != userID {
+		return nil, commandError("You can only change your own entries.")
+	}
+
+	return item, nil
+}
+
+// A token which posts items to a route, with the templates it uses
+type poster struct {
+	route     string
+	token     string
+	templates *render.Set
+}
+
+func posters(config Configuration) []poster {
+	list := []poster{{os.Getenv("WORKING_CHANNEL"), os.Getenv("BOT_TOKEN"), config.templates}}
+	for _, item := range config.Items {
+		list = append(list, poster{item.Channel, item.token, item.templates})
+	}
+
+	return list
+}
+
+// Run f with the token and templates which posted the post.
+// Posts are matched by the identity of the bot which posted them. Older
+// posts without it are tried with every token of their route until one works,
+// since the same channel name may exist in several teams.
+func withPoster(config Configuration, post store.Post, f func(token string, templates *render.Set) error) error {
+	var err error = fmt.Errorf("No token posts to %s", post.Route)
+
+	for _, p := range posters(config) {
+		if p.route != post.Route {
+			continue
+		}
+
+		if post.Team != "" {
+			identity, err := bot.IdentityOf(p.token)
+			if err != nil || !identity.Owns(post) {
+				continue
+			}
+
+			return f(p.token, p.templates)
+		}
+
+		if err = f(p.token, p.templates); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Buttons under a repost: resolve for open blockers, and edit and delete
+// when enabled
+func itemAttachments(item *store.Item) []slack.Attachment {
+	var attachments []slack.Attachment
+	if item.Blocking() {
+		attachments = append(attachments, blockerAttachments(item)...)
+	}
+
+	if os.Getenv("ITEM_ACTIONS") == "true" {
+		attachments = append(attachments, itemActionAttachments(item)...)
+	}
+
+	return attachments
+}
+
+// Buttons under a repost to edit or delete the item
+func itemActionAttachments(item *store.Item) []slack.Attachment {
+	return []slack.Attachment{
+		slack.Attachment{
+			Fallback:   "Use /working edit or /working delete to change this entry",
+			CallbackID: "item",
+			Actions: []slack.AttachmentAction{
+				slack.AttachmentAction{Name: "edit", Text: "Edit", Type: "button", Value: item.ID.Hex()},
+				slack.AttachmentAction{
+					Name:  "delete",
+					Text:  "Delete",
+					Type:  "button",
+					Style: "danger",
+					Value: item.ID.Hex(),
+					Confirm: &slack.ConfirmationField{
+						Text:   "Delete this entry and its posts?",
+						OkText: "Delete",
+					},
+				},
+			},
+		},
+	}
+}
+
+// Reply to a button click, without replacing the message with the button
+type actionResponse struct {
+	slackResponse
+	ReplaceOriginal bool `json:"replace_original"`
+}
+
+// Handle clicks on the buttons of reposts, of blockers and of search
+// results, and submitted dialogs
+func itemActions(items store.ItemStore, settings *liveConfig, jobs *digestJobs) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		config := settings.Load()
+		payload := []byte(c.PostForm("payload"))
+
+		var kind struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(payload, &kind) == nil && kind.Type == "dialog_submission" {
+			var submission dialogSubmission
+			if err := json.Unmarshal(payload, &submission); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+				return
+			}
+
+			submitDialog(c, items, config, submission)
+			return
+		}
+
+		var callback struct {
+			slack.AttachmentActionCallback
+			TriggerID string `json:"trigger_id"`
+		}
+
+		err := json.Unmarshal(payload, &callback)
+		if err != nil || len(callback.Actions) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+
+		action := callback.Actions[0]
+
+		switch callback.CallbackID {
+		case "item", "blocker":
+		case "search":
+			searchAction(c, items, action, jobs.Location())
+			return
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+
+		var message string
+		switch action.Name {
+		case "edit":
+			err = openEditDialog(items, callback.User.ID, action.Value, callback.TriggerID)
+			if err == nil {
+				c.Status(http.StatusOK)
+				return
+			}
+		case "delete":
+			message, err = deleteItem(items, config, callback.User.ID, action.Value)
+		case "resolve":
+			message, err = resolveBlocker(items, config, callback.User.ID, callback.User.Name, action.Value)
+		default:
+			err = commandError("Unknown action")
+		}
+
+		// Slack only shows replies to button clicks with status 200
+		c.JSON(http.StatusOK, actionResponse{
+			slackResponse: slackResponse{ResponseType: "ephemeral", Text: replyText(message, err, "Cannot handle "+action.Name+" action")},
+		})
+	}
+}
+
+// Replace search results with the page of the button
+func searchAction(c *gin.Context, items store.ItemStore, action slack.AttachmentAction, location *time.Location) {
+	page, args, err := parseSearchPage(action.Value)
+
+	var message string
+	var attachments []slack.Attachment
+	if err == nil {
+		message, attachments, err = searchItems(items, args, page, location)
+	}
+
+	c.JSON(http.StatusOK, actionResponse{
+		slackResponse:   slackResponse{ResponseType: "ephemeral", Text: replyText(message, err, "Cannot handle search action"), Attachments: attachments},
+		ReplaceOriginal: true,
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func TestIsSubcommand(t *testing.T) {
+	tests := []struct {
+		command, args string
+		subcommand    bool
+	}{
+		{"edit", "the onboarding docs", false},
+		{"edit", "last fixed text", true},
+		{"edit", "5f8d0d55b54764421b7156c3 fixed text", true},
+		{"edit", "", true},
+		{"delete", "old branches", false},
+		{"delete", "last", true},
+		{"off", "to the dentist", false},
+		{"off", "2026-10-20..2026-10-24", true},
+		{"off", "cancel 2026-10-20", true},
+		{"nudge", "the team", false},
+		{"nudge", "OFF", true},
+		{"remind", "bob about it", false},
+		{"remind", "list", true},
+		{"search", "deploy from:@bob", true},
+		{"search", "x since:yesterday", false},
+		{"deploy", "the api", false},
+	}
+
+	for _, test := range tests {
+		if got := isSubcommand(test.command, test.args); got != test.subcommand {
+			t.Errorf("isSubcommand(%q, %q) = %v, want %v", test.command, test.args, got, test.subcommand)
+		}
+	}
+}
+
+func TestEditAndDeleteOwnItems(t *testing.T) {
+	slack := newFakeSlack(t)
+	defer slack.Close()
+
+	items := store.NewMemoryStore()
+	config := testConfig()
+
+	bob, err := addItem(items, "Write the docs", "U1", "bob", store.KindWorking, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := addItem(items, "Fix the login page", "U2", "alice", store.KindWorking, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func() (string, error)
+		err    bool
+	}{
+		{"edit of another user", func() (string, error) { return editItem(items, config, "U1", alice.ID.Hex(), "Broke the login page") }, true},
+		{"delete of another user", func() (string, error) { return deleteItem(items, config, "U1", alice.ID.Hex()) }, true},
+		{"edit of a missing item", func() (string, error) { return editItem(items, config, "U1", "5f8d0d55b54764421b7156c3", "text") }, true},
+		{"edit without text", func() (string, error) { return editItem(items, config, "U1", "last", "") }, true},
+		{"edit of a bad id", func() (string, error) { return editItem(items, config, "U1", "docs", "text") }, true},
+		{"edit of last", func() (string, error) { return editItem(items, config, "U1", "last", "Write the #classify docs") }, false},
+		{"edit by id", func() (string, error) { return editItem(items, config, "U2", alice.ID.Hex(), "Fix the signup page") }, false},
+		{"delete of last", func() (string, error) { return deleteItem(items, config, "U1", "last") }, false},
+	}
+
+	for _, test := range tests {
+		_, err := test.change()
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if _, ok := err.(commandError); err != nil && !ok {
+			t.Errorf("%s: %s is not shown to the user", test.name, err)
+		}
+	}
+
+	if _, err := items.Get(bob.ID); err != store.ErrNotFound {
+		t.Errorf("item of bob after delete: %v", err)
+	}
+
+	stored, err := items.Get(alice.ID)
+	if err != nil || stored.Text != "Fix the signup page" {
+		t.Errorf("item of alice after edit: %+v, %v", stored, err)
+	}
+
+	// Reposts follow the edits and the delete
+	if updates := slack.called("chat.update"); len(updates) != 2 || updates[1].Get("text") == "" {
+		t.Errorf("updates: %v", updates)
+	}
+	if deletes := slack.called("chat.delete"); len(deletes) != 1 || deletes[0].Get("ts") != bob.Posts[0].Timestamp {
+		t.Errorf("deletes: %v", deletes)
+	}
+}
+
+func TestParseEdit(t *testing.T) {
+	tests := []struct {
+		kind     string
+		values   map[string]string
+		text     string
+		estimate time.Duration
+		blockers string
+		errors   []string
+	}{
+		{store.KindWorking, map[string]string{"description": " Deploy the API ", "estimate": "1d 4h", "blockers": "keys"}, "Deploy the API", 28 * time.Hour, "keys", nil},
+		{store.KindWorking, map[string]string{"description": "Deploy", "estimate": ""}, "Deploy", 0, "", nil},
+		{store.KindDone, map[string]string{"description": "Deployed"}, "Deployed", 0, "", nil},
+		{store.KindWorking, map[string]string{"description": "", "estimate": "soon"}, "Old", time.Hour, "", []string{"description", "estimate"}},
+	}
+
+	for _, test := range tests {
+		item := &store.Item{Kind: test.kind, Text: "Old"}
+		if test.kind == store.KindWorking {
+			item.Estimate = time.Hour
+		}
+		errs := parseEdit(item, dialogSubmission{Submission: test.values})
+
+		var names []string
+		for _, e := range errs {
+			names = append(names, e.Name)
+		}
+		if len(names) != len(test.errors) || len(names) > 0 && names[len(names)-1] != test.errors[len(test.errors)-1] {
+			t.Errorf("parseEdit(%v): errors %v, want %v", test.values, names, test.errors)
+		}
+
+		if item.Text != test.text || item.Estimate != test.estimate || item.Blockers != test.blockers {
+			t.Errorf("parseEdit(%v): %q %s %q", test.values, item.Text, item.Estimate, item.Blockers)
+		}
+	}
+}
+
+func TestFormatEstimate(t *testing.T) {
+	for _, estimate := range []time.Duration{0, 30 * time.Minute, 2 * time.Hour, 28*time.Hour + 30*time.Minute} {
+		parsed, err := parseEstimate(formatEstimate(estimate))
+		if err != nil || parsed != estimate {
+			t.Errorf("estimate %s is formatted %q and parsed %s, %v", estimate, formatEstimate(estimate), parsed, err)
+		}
+	}
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dwarvesf/working-on/calendar"
+	"github.com/dwarvesf/working-on/remind"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/route"
+	"github.com/dwarvesf/working-on/secret"
+	"github.com/dwarvesf/working-on/store"
+)
+
+type Configuration struct {
+	Items []ConfigurationItem `json:"items"`
+
+	// Template files by name, used by every item unless it has its own
+	Templates map[string]string `json:"templates,omitempty"`
+	templates *render.Set
+
+	// Messages posted on a schedule, besides the ones added at runtime
+	Reminders []store.Reminder `json:"reminders,omitempty"`
+
+	// iCalendar files of holidays, for every item and reminder
+	Holidays []string `json:"holidays,omitempty"`
+	holidays *calendar.Calendar
+
+	// Kind of item made from a message when its author reacts to it with
+	// the emoji, e.g. "white_check_mark": "done"
+	Reactions map[string]string `json:"reactions,omitempty"`
+
+	// Slack user id of the lead of each tag, pinged when an item with the
+	// tag is blocked, e.g. "#classify": "U024BE7LH"
+	Leads map[string]string `json:"leads,omitempty"`
+}
+
+type ConfigurationItem struct {
+	Channel string   `json:"channel"`
+	Tags    []string `json:"tags"`
+
+	// Rule of the items the channel gets, see route.Parse, and the rule of
+	// both tags and match. An item must match both when both are given.
+	Match string `json:"match,omitempty"`
+	rule  route.Rule
+
+	// Reference to the bot token, see secret.Resolve, and the token itself
+	Token string `json:"token"`
+	token string
+
+	// Digest schedule: "15:04" time, IANA timezone and weekday names.
+	// Defaults are DIGEST_TIME, UTC and every day.
+	Time     string   `json:"time,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Period is daily (default), weekly or monthly.
+	// Monthly roll-ups are posted on MonthDay.
+	Period   string `json:"period,omitempty"`
+	MonthDay int    `json:"monthday,omitempty"`
+
+	// Template files by name, see render.Defaults for names
+	Templates map[string]string `json:"templates,omitempty"`
+	templates *render.Set
+
+	// Direct messages to people of the team who posted nothing today, optional
+	Nudge *NudgeConfiguration `json:"nudge,omitempty"`
+
+	// iCalendar files of holidays of the team, on top of the ones of the file
+	Holidays []string `json:"holidays,omitempty"`
+	holidays *calendar.Calendar
+}
+
+// Nudge schedule, timezone and weekdays default to the ones of the digest
+type NudgeConfiguration struct {
+	Time     string   `json:"time"`
+	Timezone string   `json:"timezone,omitempty"`
+	Weekdays []string `json:"weekdays,omitempty"`
+}
+
+// Kinds of configuration files, they share a format but not its meaning
+type configKind int
+
+const (
+	// setting.json routes reposts by tag
+	settingFile configKind = iota
+	// digest.json schedules digests, nudges and reminders
+	digestFile
+)
+
+// Channel names as Slack allows them, or channel ids
+var validChannel = regexp.MustCompile(`^(#[a-z0-9_][a-z0-9_.-]{0,79}|[CGD][A-Z0-9]{8,})$`)
+
+// User ids, mentions need them rather than names
+var validUser = regexp.MustCompile(`^[UW][A-Z0-9]{8,}$`)
+
+// Parse and check a configuration file. Every problem found is reported with
+// its line, column and field, e.g. "digest.json:12:13: items[1].tags[0]: Empty tag".
+func parseConfig(path string, kind configKind) (*Configuration, error) {
+	var configuration Configuration
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read %s: %s", path, err)
+	}
+
+	doc := newDocument(path, content)
+
+	// Unknown fields are usually typos of known ones, which would silently be left empty
+	if err := doc.walk(json.NewDecoder(bytes.NewReader(content)), "", reflect.TypeOf(configuration)); err != nil {
+		doc.syntaxError(err)
+		return nil, doc.errors
+	}
+
+	if err := json.Unmarshal(content, &configuration); err != nil {
+		doc.syntaxError(err)
+		return nil, doc.errors
+	}
+
+	configuration.check(doc, kind)
+	if len(doc.errors) > 0 {
+		return nil, doc.errors
+	}
+
+	return &configuration, nil
+}
+
+// Check fields and load templates and holidays the configuration refers to
+func (c *Configuration) check(doc *document, kind configKind) {
+	var err error
+
+	// Load templates of the file then of each item on top of them
+	c.templates, err = render.Load(render.Default(), c.Templates)
+	if err != nil {
+		doc.errorf("templates", "%s", err)
+		c.templates = render.Default()
+	}
+
+	c.holidays, err = calendar.Load(c.Holidays...)
+	if err != nil {
+		doc.errorf("holidays", "%s", err)
+	}
+
+	for i := range c.Items {
+		item := &c.Items[i]
+		field := fmt.Sprintf("items[%d]", i)
+
+		item.templates, err = render.Load(c.templates, item.Templates)
+		if err != nil {
+			doc.errorf(field+".templates", "%s", err)
+		}
+
+		holidays, err := calendar.Load(item.Holidays...)
+		if err != nil {
+			doc.errorf(field+".holidays", "%s", err)
+		}
+		item.holidays = c.holidays.Merge(holidays)
+
+		checkChannel(doc, field+".channel", item.Channel)
+		item.token = resolveToken(doc, field+".token", item.Token)
+
+		if item.Tags != nil && len(item.Tags) == 0 {
+			doc.errorf(field+".tags", "No tags, leave tags out to match every item")
+		}
+		for j, tag := range item.Tags {
+			if strings.TrimSpace(tag) == "" {
+				doc.errorf(fmt.Sprintf("%s.tags[%d]", field, j), "Empty tag")
+			}
+		}
+
+		var match route.Rule
+		if item.Match != "" {
+			match, err = route.Parse(item.Match)
+			if err != nil {
+				doc.errorf(field+".match", "%s", err)
+			}
+		}
+		item.rule = route.And(route.Tags(item.Tags), match)
+
+		if kind == settingFile && item.rule == nil && item.Match == "" {
+			doc.errorf(field, "No tags or match, no item would be posted")
+		}
+
+		if kind != digestFile {
+			continue
+		}
+
+		if _, _, err := digestSchedule(*item); err != nil {
+			doc.errorf(field, "Invalid digest schedule: %s", err)
+		}
+
+		if item.Nudge != nil {
+			if _, err := nudgeSchedule(*item); err != nil {
+				doc.errorf(field+".nudge", "Invalid nudge schedule: %s", err)
+			}
+		}
+	}
+
+	// Sorted, so errors come in the same order every time
+	var emojis []string
+	for emoji := range c.Reactions {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+
+	for _, emoji := range emojis {
+		kind := c.Reactions[emoji]
+		field := "reactions." + emoji
+
+		if emoji == "" || strings.ContainsAny(emoji, ": ") {
+			doc.errorf(field, "Invalid emoji %q, expected its name without colons", emoji)
+		}
+
+		if kind != store.KindWorking && kind != store.KindDone && kind != store.KindTIL && kind != store.KindBlocked {
+			doc.errorf(field, "Unknown kind %q, expected working, done, til or blocked", kind)
+		}
+	}
+
+	var tags []string
+	for tag := range c.Leads {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		field := "leads." + tag
+
+		if found := store.Hashtags(tag); len(found) != 1 || found[0] != strings.ToLower(tag) {
+			doc.errorf(field, "Invalid tag %q, expected a hashtag like #classify", tag)
+		}
+
+		if !validUser.MatchString(c.Leads[tag]) {
+			doc.errorf(field, "Invalid lead %q, expected a Slack user id like U024BE7LH", c.Leads[tag])
+		}
+	}
+
+	for i, reminder := range c.Reminders {
+		field := fmt.Sprintf("reminders[%d]", i)
+
+		checkChannel(doc, field+".channel", reminder.Channel)
+		if reminder.Token != "" {
+			resolveToken(doc, field+".token", reminder.Token)
+		}
+
+		if err := remind.Validate(reminder); err != nil {
+			doc.errorf(field, "%s", err)
+		}
+	}
+}
+
+func checkChannel(doc *document, field, channel string) {
+	if channel == "" {
+		doc.errorf(field, "Missing channel")
+	} else if !validChannel.MatchString(channel) {
+		doc.errorf(field, "Invalid channel %q, expected #name in lower case or a channel id", channel)
+	}
+}
+
+// Token of the reference in the field. Literal tokens are reported with
+// every other literal token of the document.
+func resolveToken(doc *document, field, ref string) string {
+	if ref == "" {
+		doc.errorf(field, "Missing token")
+		return ""
+	}
+
+	token, err := secret.Resolve(ref)
+	if err != nil && err != secret.ErrLiteral {
+		doc.errorf(field, "%s", err)
+	}
+
+	return token
+}
+
+// Problem in a configuration file, at the line and column of a field
+type configError struct {
+	path    string
+	line    int
+	column  int
+	field   string
+	message string
+}
+
+func (e configError) Error() string {
+	if e.field == "" {
+		return fmt.Sprintf("%s:%d:%d: %s", e.path, e.line, e.column, e.message)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s: %s", e.path, e.line, e.column, e.field, e.message)
+}
+
+// Every problem of a configuration file, one per line
+type configErrors []configError
+
+func (e configErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// JSON document which knows where each of its fields is, e.g. "items[1].tags[0]"
+type document struct {
+	path    string
+	content []byte
+	offsets map[string]int64
+	errors  configErrors
+}
+
+func newDocument(path string, content []byte) *document {
+	return &document{path: path, content: content, offsets: map[string]int64{"": 0}}
+}
+
+// Report a problem at the field, or at its closest parent which is in the document
+func (d *document) errorf(field string, format string, args ...interface{}) {
+	offset, ok := d.offsets[field]
+	for parent := field; !ok && parent != ""; {
+		if i := strings.LastIndexAny(parent, ".["); i >= 0 {
+			parent = parent[:i]
+		} else {
+			parent = ""
+		}
+		offset, ok = d.offsets[parent]
+	}
+
+	d.errorAt(offset, field, fmt.Sprintf(format, args...))
+}
+
+func (d *document) errorAt(offset int64, field, message string) {
+	line, column := 1, 1
+	for _, b := range d.content[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	d.errors = append(d.errors, configError{d.path, line, column, field, message})
+}
+
+// Report an error of the JSON decoder where it happened
+func (d *document) syntaxError(err error) {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// The offset is past the character which is wrong
+		d.errorAt(d.clamp(e.Offset-1), "", e.Error())
+	case *json.UnmarshalTypeError:
+		field := fieldPath(e.Field)
+		if _, ok := d.offsets[field]; ok {
+			d.errorf(field, "Expected %s, got %s", e.Type, e.Value)
+		} else {
+			d.errorAt(d.clamp(e.Offset), field, fmt.Sprintf("Expected %s, got %s", e.Type, e.Value))
+		}
+	default:
+		d.errorAt(0, "", err.Error())
+	}
+}
+
+// Field path of encoding/json, "items.0.tags", as the document has it, "items[0].tags"
+func fieldPath(field string) string {
+	var b bytes.Buffer
+
+	for i, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			b.WriteString("[" + part + "]")
+			continue
+		}
+
+		if i > 0 {
+			b.WriteString(".")
+		}
+		b.WriteString(part)
+	}
+
+	return b.String()
+}
+
+func (d *document) clamp(offset int64) int64 {
+	if offset < 0 {
+		return 0
+	}
+
+	if offset > int64(len(d.content)) {
+		return int64(len(d.content))
+	}
+
+	return offset
+}
+
+// Offset of the next token from the decoder offset, which is at the end of
+// the previous one
+func (d *document) next(offset int64) int64 {
+	for offset < int64(len(d.content)) && strings.IndexByte(" \t\r\n,:", d.content[offset]) >= 0 {
+		offset++
+	}
+
+	return offset
+}
+
+// Record the offset of every field of the value and report the fields which
+// type t does not have. A nil t accepts anything.
+func (d *document) walk(dec *json.Decoder, field string, t reflect.Type) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for dec.More() {
+			offset := d.next(dec.InputOffset())
+
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			key, _ := token.(string)
+			name := key
+			if field != "" {
+				name = field + "." + key
+			}
+			d.offsets[name] = offset
+
+			var elem reflect.Type
+			if t != nil {
+				switch t.Kind() {
+				case reflect.Struct:
+					f, ok := jsonField(t, key)
+					if !ok {
+						d.errorAt(offset, name, "Unknown field")
+					}
+					elem = f
+				case reflect.Map:
+					elem = t.Elem()
+				}
+			}
+
+			if err := d.walk(dec, name, elem); err != nil {
+				return err
+			}
+		}
+
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			name := fmt.Sprintf("%s[%d]", field, i)
+			d.offsets[name] = d.next(dec.InputOffset())
+
+			var elem reflect.Type
+			if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+				elem = t.Elem()
+			}
+
+			if err := d.walk(dec, name, elem); err != nil {
+				return err
+			}
+		}
+
+		_, err = dec.Token()
+		return err
+	}
+
+	// Tokens must not be committed, wherever they are
+	if s, ok := token.(string); ok && secret.IsLiteral(s) {
+		d.errorf(field, "%s", secret.ErrLiteral)
+	}
+
+	return nil
+}
+
+// Type of the field of the struct with the JSON name, matched like
+// encoding/json does
+func jsonField(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+
+		if strings.EqualFold(tag, name) {
+			return f.Type, true
+		}
+	}
+
+	return nil, false
+}
+
+// The current configuration of a file, swapped as a whole when the file is
+// reloaded. A request loads it once, so it sees the same one throughout.
+type liveConfig struct {
+	value atomic.Value
+}
+
+func newLiveConfig(c *Configuration) *liveConfig {
+	live := &liveConfig{}
+	live.Store(c)
+	return live
+}
+
+func (l *liveConfig) Load() Configuration {
+	return *l.value.Load().(*Configuration)
+}
+
+func (l *liveConfig) Store(c *Configuration) {
+	l.value.Store(c)
+}
+
+// Interval between checks of configuration files for changes
+const configPollInterval = 5 * time.Second
+
+// Call reload with the configuration of the file each time the file, or a
+// template or holidays file it refers to, changes or the process gets
+// SIGHUP. A configuration with problems is reported and left out, the
+// current one stays.
+func watchConfig(path string, kind configKind, current *Configuration, reload func(c *Configuration)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(configPollInterval)
+	files := append([]string{path}, current.files()...)
+	modTimes := modified(files)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+			case <-ticker.C:
+				if !changed(files, modTimes) {
+					continue
+				}
+			}
+
+			modTimes = modified(files)
+
+			c, err := parseConfig(path, kind)
+			if err != nil {
+				log.Errorf("Cannot reload %s, keeping the current configuration", path)
+				logConfigError(err)
+				continue
+			}
+
+			// The new configuration may refer to other files
+			files = append([]string{path}, c.files()...)
+			modTimes = modified(files)
+
+			reload(c)
+			log.Infof("Reloaded %s", path)
+		}
+	}()
+}
+
+// Template and holidays files the configuration loads, without duplicates
+func (c *Configuration) files() []string {
+	var files []string
+	seen := map[string]bool{}
+	add := func(paths ...string) {
+		for _, path := range paths {
+			if !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+		}
+	}
+
+	templateFiles := func(templates map[string]string) {
+		for _, path := range templates {
+			add(path)
+		}
+	}
+
+	templateFiles(c.Templates)
+	add(c.Holidays...)
+	for _, item := range c.Items {
+		templateFiles(item.Templates)
+		add(item.Holidays...)
+	}
+
+	return files
+}
+
+// Log each problem of a configuration file on its own line
+func logConfigError(err error) {
+	errs, ok := err.(configErrors)
+	if !ok {
+		log.Errorln(err)
+		return
+	}
+
+	for _, e := range errs {
+		log.Errorln(e)
+	}
+}
+
+// Modification time of each file, zero when it cannot be read
+func modified(paths []string) []time.Time {
+	times := make([]time.Time, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+
+	return times
+}
+
+// Check if a file was modified since the times
+func changed(paths []string, times []time.Time) bool {
+	for i, t := range modified(paths) {
+		if !t.Equal(times[i]) {
+			return true
+		}
+	}
+
+	return false
+}
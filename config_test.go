@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dwarvesf/working-on/secret"
+)
+
+func TestParseConfigErrors(t *testing.T) {
+	os.Setenv("CONFIG_TEST_TOKEN", "xoxb-test")
+	defer os.Unsetenv("CONFIG_TEST_TOKEN")
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "setting.json")
+
+	tests := []struct {
+		name    string
+		kind    configKind
+		content string
+		errors  []string
+	}{
+		{
+			"valid",
+			settingFile,
+			`{"items": [{"channel": "#working", "tags": ["#classify"], "token": "env:CONFIG_TEST_TOKEN"}]}`,
+			nil,
+		},
+		{
+			"empty tag",
+			settingFile,
+			"{\n  \"items\": [\n    {\n      \"channel\": \"#working\",\n      \"tags\": [\"#classify\", \" \"],\n      \"token\": \"env:CONFIG_TEST_TOKEN\"\n    }\n  ]\n}\n",
+			[]string{"setting.json:5:29: items[0].tags[1]: Empty tag"},
+		},
+		{
+			"unknown field",
+			settingFile,
+			"{\n  \"items\": [\n    {\n      \"chanel\": \"#working\",\n      \"tags\": [\"#classify\"],\n      \"token\": \"env:CONFIG_TEST_TOKEN\"\n    }\n  ]\n}\n",
+			[]string{"setting.json:4:7: items[0].chanel: Unknown field", "setting.json:3:5: items[0].channel: Missing channel"},
+		},
+		{
+			"every problem of an item, at its keys or at the item",
+			settingFile,
+			"{\n  \"items\": [\n    {\"channel\": \"#working\", \"tags\": [\"#classify\"], \"token\": \"env:CONFIG_TEST_TOKEN\"},\n    {\"channel\": \"#Working\", \"tags\": []}\n  ]\n}\n",
+			[]string{
+				`setting.json:4:6: items[1].channel: Invalid channel "#Working", expected #name in lower case or a channel id`,
+				"setting.json:4:5: items[1].token: Missing token",
+				"setting.json:4:29: items[1].tags: No tags, leave tags out to match every item",
+				"setting.json:4:5: items[1]: No tags or match, no item would be posted",
+			},
+		},
+		{
+			"literal token",
+			settingFile,
+			"{\"items\": [{\"channel\": \"#working\", \"tags\": [\"#classify\"],\n\t\"token\": \"xoxb-1234-abcd\"}]}\n",
+			[]string{"setting.json:2:2: items[0].token: " + secret.ErrLiteral.Error()},
+		},
+		{
+			"wrong type",
+			settingFile,
+			"{\n  \"items\": [\n    {\"channel\": \"#working\", \"tags\": \"#classify\", \"token\": \"env:CONFIG_TEST_TOKEN\"}\n  ]\n}\n",
+			[]string{"setting.json:3:29: items[0].tags: Expected []string, got string"},
+		},
+		{
+			"syntax error",
+			settingFile,
+			"{\n  \"items\": [\n    {\"channel\": \"#working\" \"tags\": [\"#classify\"]}\n  ]\n}\n",
+			[]string{"setting.json:3:28: invalid character '\"' after object key:value pair"},
+		},
+		{
+			"digest schedule",
+			digestFile,
+			"{\n  \"items\": [\n    {\"channel\": \"#working\", \"token\": \"env:CONFIG_TEST_TOKEN\", \"time\": \"25:00\"}\n  ]\n}\n",
+			[]string{"setting.json:3:5: items[0]: Invalid digest schedule: Invalid hour in \"25:00\""},
+		},
+	}
+
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := parseConfig(path, test.kind)
+
+		var got []string
+		if err != nil {
+			got = strings.Split(strings.Replace(err.Error(), path, "setting.json", -1), "\n")
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.errors, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.errors, "\n"))
+		}
+	}
+}
+
+func TestConfigFilesChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	template, holidays := filepath.Join(dir, "digest.tmpl"), filepath.Join(dir, "holidays.ics")
+	for _, path := range []string{template, holidays} {
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := Configuration{
+		Templates: map[string]string{"digest": template},
+		Items: []ConfigurationItem{
+			{Templates: map[string]string{"digest": template}, Holidays: []string{holidays}},
+		},
+	}
+
+	files := config.files()
+	if len(files) != 2 || files[0] != template || files[1] != holidays {
+		t.Fatalf("files: got %v, want %s and %s", files, template, holidays)
+	}
+
+	times := modified(files)
+	if changed(files, times) {
+		t.Errorf("files changed without a change")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(holidays, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !changed(files, times) {
+		t.Errorf("change of %s is not seen", holidays)
+	}
+}
@@ -1,25 +1,124 @@
 package db
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 )
 
+var ErrNotConnected = errors.New("Database is not connected")
+
+// Options of the process-wide Mongo session
+type Options struct {
+	URL      string
+	Database string
+
+	// Maximum number of sockets per server, 0 keeps mgo default
+	PoolLimit int
+
+	// Timeout for dialing and for each socket operation
+	Timeout time.Duration
+
+	// Attempts to reach the server on start, waiting Backoff after the
+	// first failure and twice as long after each following one
+	Attempts int
+	Backoff  time.Duration
+}
+
+// OptionsFromEnv reads options from env, falling back to sane defaults
+func OptionsFromEnv() Options {
+	return Options{
+		URL:       os.Getenv("MONGOLAB_URI"),
+		Database:  os.Getenv("DB_NAME"),
+		PoolLimit: envInt("MONGO_POOL_LIMIT", 0),
+		Timeout:   time.Duration(envInt("MONGO_TIMEOUT", 10)) * time.Second,
+		Attempts:  envInt("MONGO_CONNECT_ATTEMPTS", 5),
+		Backoff:   time.Second,
+	}
+}
+
+var (
+	mu       sync.RWMutex
+	session  *mgo.Session
+	database string
+)
+
+// Connect dials the server once for the whole process.
+// Contexts copy this session, so they share its socket pool.
+func Connect(opts Options) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if session != nil {
+		return nil
+	}
+
+	var s *mgo.Session
+	var err error
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		s, err = mgo.DialWithTimeout(opts.URL, opts.Timeout)
+		if err == nil {
+			err = s.Ping()
+			if err == nil {
+				break
+			}
+			s.Close()
+		}
+
+		if attempt >= opts.Attempts {
+			return err
+		}
+
+		log.Warnf("Cannot reach database (attempt %d/%d): %s. Retry in %s", attempt, opts.Attempts, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if opts.PoolLimit > 0 {
+		s.SetPoolLimit(opts.PoolLimit)
+	}
+	s.SetSocketTimeout(opts.Timeout)
+	s.SetSyncTimeout(opts.Timeout)
+
+	session = s
+	database = opts.Database
+
+	return nil
+}
+
+// Close closes the process-wide session, it is called on shutdown
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if session != nil {
+		session.Close()
+		session = nil
+	}
+}
+
 type Context struct {
 	Database *mgo.Database
 }
 
+// NewContext returns a context with its own copy of the process-wide session.
+// The context must be closed to give the socket back to the pool.
 func NewContext() (*Context, error) {
-	dbURL := os.Getenv("MONGOLAB_URI")
-	AuthDatabase := os.Getenv("DB_NAME")
-	session, err := mgo.Dial(dbURL)
-	if err != nil {
-		return nil, err
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if session == nil {
+		return nil, ErrNotConnected
 	}
 
 	ctx := &Context{
-		Database: session.Clone().DB(AuthDatabase),
+		Database: session.Copy().DB(database),
 	}
 
 	return ctx, nil
@@ -33,3 +132,12 @@ func (c *Context) Close() {
 func (c *Context) C(name string) *mgo.Collection {
 	return c.Database.C(name)
 }
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Callback ids of the dialog of `/working` without text, and of the dialog
+// of the edit button of reposts
+const (
+	entryDialogID = "entry"
+	editDialogID  = "edit"
+)
+
+// Dialog of Slack, see https://api.slack.com/dialogs
+type dialog struct {
+	CallbackID  string          `json:"callback_id"`
+	Title       string          `json:"title"`
+	SubmitLabel string          `json:"submit_label,omitempty"`
+	Elements    []dialogElement `json:"elements"`
+
+	// Sent back with the submission, the id of the edited item
+	State string `json:"state,omitempty"`
+}
+
+type dialogElement struct {
+	Type        string         `json:"type"`
+	Label       string         `json:"label"`
+	Name        string         `json:"name"`
+	Value       string         `json:"value,omitempty"`
+	Placeholder string         `json:"placeholder,omitempty"`
+	Hint        string         `json:"hint,omitempty"`
+	Optional    bool           `json:"optional,omitempty"`
+	MaxLength   int            `json:"max_length,omitempty"`
+	Options     []dialogOption `json:"options,omitempty"`
+}
+
+type dialogOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Submitted dialog, its values are by element name
+type dialogSubmission struct {
+	CallbackID string `json:"callback_id"`
+	User       struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"user"`
+	Submission  map[string]string `json:"submission"`
+	ResponseURL string            `json:"response_url"`
+	State       string            `json:"state"`
+}
+
+// Problem of a submitted value, Slack shows it under the element
+type dialogError struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// Estimates like "2h", "1h30m" or "1d 4h", a day is 24 hours as in durations
+var estimatePattern = regexp.MustCompile(`^(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?$`)
+
+// Dialog of a structured entry, project tags are the ones of setting.json
+func entryDialog(config Configuration) dialog {
+	elements := []dialogElement{
+		{
+			Type:  "select",
+			Label: "Kind",
+			Name:  "kind",
+			Value: store.KindWorking,
+			Options: []dialogOption{
+				{"Working on", store.KindWorking},
+				{"Done", store.KindDone},
+				{"Today I learned", store.KindTIL},
+				{"Blocked", store.KindBlocked},
+			},
+		},
+		{
+			Type:        "textarea",
+			Label:       "Description",
+			Name:        "description",
+			Placeholder: "What are you working on?",
+			MaxLength:   3000,
+		},
+	}
+
+	if tags := projectTags(config); len(tags) > 0 {
+		project := dialogElement{Type: "select", Label: "Project", Name: "tag", Optional: true}
+		for _, tag := range tags {
+			project.Options = append(project.Options, dialogOption{tag, tag})
+		}
+		elements = append(elements, project)
+	}
+
+	elements = append(elements,
+		dialogElement{
+			Type:        "text",
+			Label:       "Estimate",
+			Name:        "estimate",
+			Placeholder: "2h",
+			Hint:        "Working entries only, e.g. 30m, 2h or 1d 4h",
+			Optional:    true,
+		},
+		dialogElement{
+			Type:     "textarea",
+			Label:    "Blockers",
+			Name:     "blockers",
+			Hint:     "Working entries only, what stops you if anything",
+			Optional: true,
+		},
+	)
+
+	return dialog{CallbackID: entryDialogID, Title: "New entry", SubmitLabel: "Save", Elements: elements}
+}
+
+// Tags of the items of the configuration, without repeats
+func projectTags(config Configuration) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	for _, item := range config.Items {
+		for _, tag := range item.Tags {
+			tag = store.NormalizeTag(tag)
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// Open the entry dialog for the user of the slash command
+func openEntryDialog(c *gin.Context, config Configuration) error {
+	return bot.OpenDialog(os.Getenv("BOT_TOKEN"), c.PostForm("trigger_id"), entryDialog(config))
+}
+
+// Dialog to edit an item, filled with its values. Only working items have
+// an estimate and blockers.
+func editDialog(item *store.Item) dialog {
+	elements := []dialogElement{
+		{
+			Type:      "textarea",
+			Label:     "Description",
+			Name:      "description",
+			Value:     item.Text,
+			MaxLength: 3000,
+		},
+	}
+
+	if item.Kind == store.KindWorking {
+		elements = append(elements,
+			dialogElement{
+				Type:        "text",
+				Label:       "Estimate",
+				Name:        "estimate",
+				Value:       formatEstimate(item.Estimate),
+				Placeholder: "2h",
+				Hint:        "e.g. 30m, 2h or 1d 4h",
+				Optional:    true,
+			},
+			dialogElement{
+				Type:     "textarea",
+				Label:    "Blockers",
+				Name:     "blockers",
+				Value:    item.Blockers,
+				Hint:     "What stops you if anything",
+				Optional: true,
+			},
+		)
+	}
+
+	return dialog{CallbackID: editDialogID, Title: "Edit entry", SubmitLabel: "Save", Elements: elements, State: item.ID.Hex()}
+}
+
+// Open the edit dialog of an item of the user, from the edit button
+func openEditDialog(items store.ItemStore, userID, ref, triggerID string) error {
+	item, err := findOwnItem(items, userID, ref)
+	if err != nil {
+		return err
+	}
+
+	return bot.OpenDialog(os.Getenv("BOT_TOKEN"), triggerID, editDialog(item))
+}
+
+// Handle a submitted dialog. Invalid values are shown in the dialog, the
+// confirmation goes to the response URL since the dialog closes.
+func submitDialog(c *gin.Context, items store.ItemStore, config Configuration, submission dialogSubmission) {
+	switch submission.CallbackID {
+	case entryDialogID:
+	case editDialogID:
+		submitEdit(c, items, config, submission)
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	item, errs := parseEntry(config, submission)
+	if len(errs) > 0 {
+		c.JSON(http.StatusOK, gin.H{"errors": errs})
+		return
+	}
+
+	c.Status(http.StatusOK)
+
+	go func() {
+		message, err := addEntry(items, config, item)
+		message = replyText(message, err, "Cannot add item of "+item.Name)
+
+		if err := bot.Respond(submission.ResponseURL, message); err != nil {
+			log.Errorf("Cannot respond to %s: %s", item.Name, err)
+		}
+	}()
+}
+
+// Item of a submitted entry dialog, or the problems of its values
+func parseEntry(config Configuration, submission dialogSubmission) (store.Item, []dialogError) {
+	values := submission.Submission
+	var errs []dialogError
+
+	kind := values["kind"]
+	if kind != store.KindWorking && kind != store.KindDone && kind != store.KindTIL && kind != store.KindBlocked {
+		errs = append(errs, dialogError{"kind", "Choose a kind"})
+	}
+
+	text := strings.TrimSpace(values["description"])
+	if text == "" {
+		errs = append(errs, dialogError{"description", "Please tell me what it is"})
+	}
+
+	// The project is a tag of the text, unless the text has it already
+	if tag := values["tag"]; tag != "" {
+		known := false
+		for _, t := range projectTags(config) {
+			known = known || t == tag
+		}
+
+		switch {
+		case !known:
+			errs = append(errs, dialogError{"tag", "Unknown project"})
+		case text != "" && !contains(store.Hashtags(text), tag):
+			text += " " + tag
+		}
+	}
+
+	estimate, err := parseEstimate(values["estimate"])
+	if err != nil {
+		errs = append(errs, dialogError{"estimate", err.Error()})
+	} else if estimate > 0 && kind != store.KindWorking {
+		errs = append(errs, dialogError{"estimate", "Only working entries have an estimate"})
+	}
+
+	blockers := strings.TrimSpace(values["blockers"])
+	if blockers != "" && kind != store.KindWorking {
+		errs = append(errs, dialogError{"blockers", "Only working entries have blockers"})
+	}
+
+	item := newItem(text, submission.User.ID, submission.User.Name, kind)
+	item.Estimate = estimate
+	item.Blockers = blockers
+
+	return item, errs
+}
+
+// Update the item of a submitted edit dialog and its posts
+func submitEdit(c *gin.Context, items store.ItemStore, config Configuration, submission dialogSubmission) {
+	item, err := findOwnItem(items, submission.User.ID, submission.State)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"errors": []dialogError{{"description", replyText("", err, "Cannot edit item of "+submission.User.Name)}}})
+		return
+	}
+
+	if errs := parseEdit(item, submission); len(errs) > 0 {
+		c.JSON(http.StatusOK, gin.H{"errors": errs})
+		return
+	}
+
+	c.Status(http.StatusOK)
+
+	go func() {
+		message, err := updateItem(items, config, item)
+		message = replyText(message, err, "Cannot edit item of "+submission.User.Name)
+
+		if err := bot.Respond(submission.ResponseURL, message); err != nil {
+			log.Errorf("Cannot respond to %s: %s", submission.User.Name, err)
+		}
+	}()
+}
+
+// Set the values of a submitted edit dialog on the item, or return their
+// problems
+func parseEdit(item *store.Item, submission dialogSubmission) []dialogError {
+	values := submission.Submission
+	var errs []dialogError
+
+	text := strings.TrimSpace(values["description"])
+	if text == "" {
+		errs = append(errs, dialogError{"description", "Please tell me what it is"})
+	}
+
+	estimate, err := parseEstimate(values["estimate"])
+	if err != nil {
+		errs = append(errs, dialogError{"estimate", err.Error()})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	item.SetText(text)
+	if item.Kind == store.KindWorking {
+		item.Estimate = estimate
+		item.Blockers = strings.TrimSpace(values["blockers"])
+	}
+
+	return nil
+}
+
+// Store the item of the dialog. Done and learned items have nothing more
+// than their text, so they go the way of the slash commands and done items
+// may close a working item.
+func addEntry(items store.ItemStore, config Configuration, item store.Item) (string, error) {
+	if item.Kind != store.KindWorking {
+		return ingest(items, item.Kind, item.Text, item.UserID, item.Name, config, workingUsage)
+	}
+
+	if err := saveItem(items, &item, nil, config); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Saved :ok_hand: (id `%s`)", item.ID.Hex()), nil
+}
+
+// Parse an estimate, none when empty
+func parseEstimate(value string) (time.Duration, error) {
+	value = strings.Replace(strings.ToLower(value), " ", "", -1)
+	if value == "" {
+		return 0, nil
+	}
+
+	match := estimatePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("Invalid estimate, e.g. 30m, 2h or 1d 4h")
+	}
+
+	var estimate time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if match[i+1] != "" {
+			n, _ := strconv.Atoi(match[i+1])
+			estimate += time.Duration(n) * unit
+		}
+	}
+
+	return estimate, nil
+}
+
+// Estimate as the dialog takes it, e.g. "1d4h30m", empty without estimate
+func formatEstimate(estimate time.Duration) string {
+	var b bytes.Buffer
+	for _, unit := range []struct {
+		duration time.Duration
+		suffix   string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}} {
+		if n := estimate / unit.duration; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.suffix)
+			estimate -= n * unit.duration
+		}
+	}
+
+	return b.String()
+}
+
+// Tells if the list has the value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func TestParseEntry(t *testing.T) {
+	config := testConfig(ConfigurationItem{Tags: []string{"#classify", "clipchute"}})
+
+	tests := []struct {
+		values   map[string]string
+		text     string
+		estimate time.Duration
+		blockers string
+		errors   []string
+	}{
+		{map[string]string{"kind": store.KindWorking, "description": " Deploy the API ", "tag": "#classify", "estimate": "2h", "blockers": "keys"}, "Deploy the API #classify", 2 * time.Hour, "keys", nil},
+		{map[string]string{"kind": store.KindDone, "description": "Deployed the #classify API", "tag": "#classify"}, "Deployed the #classify API", 0, "", nil},
+		{map[string]string{"kind": store.KindTIL, "description": "Maps are not ordered", "tag": "#clipchute"}, "Maps are not ordered #clipchute", 0, "", nil},
+		{map[string]string{"kind": store.KindBlocked, "description": "No access to staging", "tag": "#clipchute"}, "No access to staging #clipchute", 0, "", nil},
+		{map[string]string{"kind": store.KindBlocked, "description": "No access", "blockers": "keys"}, "No access", 0, "keys", []string{"blockers"}},
+		{map[string]string{"kind": "holiday", "description": "Beach"}, "Beach", 0, "", []string{"kind"}},
+		{map[string]string{"kind": store.KindWorking, "description": "  "}, "", 0, "", []string{"description"}},
+		{map[string]string{"kind": store.KindWorking, "description": "Deploy", "tag": "#unknown"}, "Deploy", 0, "", []string{"tag"}},
+		{map[string]string{"kind": store.KindWorking, "description": "Deploy", "estimate": "soon"}, "Deploy", 0, "", []string{"estimate"}},
+		{map[string]string{"kind": store.KindDone, "description": "Deployed", "estimate": "2h", "blockers": "keys"}, "Deployed", 2 * time.Hour, "keys", []string{"estimate", "blockers"}},
+	}
+
+	for _, test := range tests {
+		submission := dialogSubmission{Submission: test.values}
+		submission.User.ID, submission.User.Name = "U1", "bob"
+
+		item, errs := parseEntry(config, submission)
+
+		var names []string
+		for _, e := range errs {
+			names = append(names, e.Name)
+		}
+		if len(names) != len(test.errors) {
+			t.Errorf("parseEntry(%v): errors %v, want %v", test.values, names, test.errors)
+		}
+		for i := range names {
+			if i < len(test.errors) && names[i] != test.errors[i] {
+				t.Errorf("parseEntry(%v): errors %v, want %v", test.values, names, test.errors)
+				break
+			}
+		}
+
+		if item.Text != test.text || item.Estimate != test.estimate || item.Blockers != test.blockers || item.UserID != "U1" {
+			t.Errorf("parseEntry(%v): %q %s %q of %s", test.values, item.Text, item.Estimate, item.Blockers, item.UserID)
+		}
+	}
+}
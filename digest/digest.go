@@ -0,0 +1,405 @@
+package digest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/calendar"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/route"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Sections of each user in the digest, in order of appearance
+var sections = []struct {
+	Kind  string
+	Title string
+}{
+	{store.KindDone, "Done"},
+	{store.KindWorking, "Working on"},
+	{store.KindBlocked, "Blocked"},
+	{store.KindTIL, "Learned"},
+}
+
+// Title of the field of open blockers, at the top of daily digests
+const blockersTitle = "Open blockers"
+
+// Items of one user in the digest period
+type userItems struct {
+	User  slack.User
+	Items []store.Item
+
+	// The user has no items but was on leave on a day of the period
+	OnLeave bool
+}
+
+// Options of a digest
+type Options struct {
+	Channel  string
+	BotToken string
+
+	// Tags of the destination, for templates
+	Tags []string
+
+	// Only items matching the rule are posted when given
+	Rule route.Rule
+
+	// Templates of title, item lines, color and footer
+	Templates *render.Set
+
+	// Weekdays the daily digest is posted on, none means every day.
+	// No digest or roll-up is posted on holidays.
+	Weekdays []time.Weekday
+	Holidays *calendar.Calendar
+}
+
+// Daily returns a job which posts the items of everyone since the previous
+// digest to the channel, usually yesterday's.
+func Daily(items store.Store, opts Options) func(at time.Time) {
+	return func(at time.Time) {
+		if h, ok := opts.Holidays.Holiday(at); ok {
+			log.Infof("No digest for %s on %s", opts.Channel, h.Name)
+			return
+		}
+
+		from, today := dailyWindow(at, opts)
+
+		s, collected, err := collect(items, opts.BotToken, opts.Rule, from, today)
+		if err != nil {
+			log.Errorf("Cannot prepare digest for %s: %s", opts.Channel, err)
+			return
+		}
+
+		blockers, err := openBlockers(items, opts, at)
+		if err != nil {
+			log.Errorf("Cannot prepare digest for %s: %s", opts.Channel, err)
+			return
+		}
+
+		// If fields is not empty, it means there is data to show
+		fields := []slack.AttachmentField{}
+		var leaves []slack.AttachmentField
+
+		// Items in the digest per kind, for the title
+		counts := map[string]int{}
+
+		for _, u := range collected {
+			if u.OnLeave {
+				value, err := opts.Templates.Render("on_leave", render.Data{User: u.User.Name})
+				if err != nil {
+					log.Errorf("Cannot prepare digest for %s: %s", opts.Channel, err)
+					return
+				}
+
+				leaves = append(leaves, slack.AttachmentField{Title: u.User.Name, Value: value})
+				continue
+			}
+
+			// Group item lines by kind so each one has own section
+			lines := map[string][]string{}
+			for _, item := range u.Items {
+				// A task which was done is shown once, as done, and an
+				// open blocker is shown at the top
+				if closedIn(item, u.Items) || item.Blocking() {
+					continue
+				}
+
+				line, err := renderItem(opts.Templates, u.User, item)
+				if err != nil {
+					log.Errorf("Cannot prepare digest for %s: %s", opts.Channel, err)
+					return
+				}
+
+				lines[kindOf(item)] = append(lines[kindOf(item)], line)
+			}
+
+			var values []string
+			userCounts := map[string]int{}
+			for _, section := range sections {
+				if len(lines[section.Kind]) == 0 {
+					continue
+				}
+
+				values = append(values, fmt.Sprintf("*%s*", section.Title))
+				values = append(values, lines[section.Kind]...)
+
+				userCounts[section.Kind] = len(lines[section.Kind])
+				counts[section.Kind] += len(lines[section.Kind])
+			}
+
+			// Their only items may be open blockers, shown at the top
+			if len(values) == 0 {
+				continue
+			}
+
+			value, err := opts.Templates.Render("user", render.Data{
+				User:   u.User.Name,
+				Items:  values,
+				Count:  len(values) - len(userCounts),
+				Counts: userCounts,
+			})
+			if err != nil {
+				log.Errorf("Cannot prepare digest for %s: %s", opts.Channel, err)
+				return
+			}
+
+			fields = append(fields, slack.AttachmentField{Title: u.User.Name, Value: value})
+		}
+
+		if len(fields) == 0 && blockers == nil {
+			return
+		}
+
+		date := from.Format(calendar.Day)
+		if last := today.AddDate(0, 0, -1); last.After(from) {
+			date += " - " + last.Format(calendar.Day)
+		}
+
+		data := render.Data{
+			Date:   date,
+			Period: PeriodDaily,
+			Tags:   opts.Tags,
+			Count:  len(fields),
+			Counts: counts,
+		}
+
+		if blockers != nil {
+			fields = append([]slack.AttachmentField{*blockers}, fields...)
+		}
+
+		if err := post(s, opts, "title", data, append(fields, leaves...)); err != nil {
+			log.Errorf("Cannot post digest to %s: %s", opts.Channel, err)
+		}
+	}
+}
+
+// Field of the blockers which are not resolved yet, whenever they were
+// posted, oldest first. Nil when there is none.
+func openBlockers(items store.Store, opts Options, now time.Time) (*slack.AttachmentField, error) {
+	list, err := items.ListBlocking()
+	if err != nil {
+		return nil, errors.New("Cannot query open blockers")
+	}
+
+	var lines []string
+	for _, item := range list {
+		if opts.Rule != nil && !opts.Rule.Match(item) {
+			continue
+		}
+
+		line, err := opts.Templates.Render("blocker", render.Data{
+			User:     item.Name,
+			Date:     item.CreatedAt.Format("2006-01-02"),
+			Text:     item.Text,
+			Kind:     item.Kind,
+			Link:     item.Permalink(),
+			Status:   status(item),
+			Age:      render.Age(item.CreatedAt, now),
+			Tags:     item.Entities.Tags,
+			Mentions: item.Entities.Mentions,
+			Channels: item.Entities.Channels,
+			URLs:     item.Entities.URLs,
+			Issues:   item.Entities.Issues,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	return &slack.AttachmentField{Title: blockersTitle, Value: strings.Join(lines, "\n")}, nil
+}
+
+// The days since the previous daily digest, until the day of at.
+// After a weekend or a holiday, this is since the last day a digest was posted
+// on, otherwise it is yesterday.
+func dailyWindow(at time.Time, opts Options) (time.Time, time.Time) {
+	from, today := Window(PeriodDaily, at)
+
+	for i := 0; i < maxDailyWindow && !postsOn(from, opts); i++ {
+		from = from.AddDate(0, 0, -1)
+	}
+
+	return from, today
+}
+
+// A digest never covers more days than this
+const maxDailyWindow = 14
+
+func postsOn(day time.Time, opts Options) bool {
+	if opts.Holidays.IsHoliday(day) {
+		return false
+	}
+
+	if len(opts.Weekdays) == 0 {
+		return true
+	}
+
+	for _, weekday := range opts.Weekdays {
+		if day.Weekday() == weekday {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Query items of every active user in the period, users without items are
+// left out unless they were on leave and the digest is not limited by a rule
+func collect(items store.Store, botToken string, rule route.Rule, from, to time.Time) (*slack.Client, []userItems, error) {
+	if botToken == "" {
+		return nil, nil, errors.New("No token provided")
+	}
+
+	s := slack.New(botToken)
+	users, err := s.GetUsers()
+	if err != nil {
+		return nil, nil, errors.New("Cannot get users")
+	}
+
+	log.Info("Preparing data")
+
+	var collected []userItems
+	for _, user := range users {
+		if user.IsBot || user.Deleted {
+			continue
+		}
+
+		list, err := items.ListByUser(user.Name, from, to)
+		if err != nil {
+			return nil, nil, errors.New("Cannot query done items")
+		}
+
+		var matched []store.Item
+		for _, item := range list {
+			log.Infof("User: %s, item: %s, rule: %v", user.Name, item.Text, rule)
+
+			// if item doesn't match the rule then don't
+			// add it to the digest message
+			if rule != nil && !rule.Match(item) {
+				continue
+			}
+
+			matched = append(matched, item)
+		}
+
+		if len(matched) > 0 {
+			collected = append(collected, userItems{User: user, Items: matched})
+			continue
+		}
+
+		if rule != nil {
+			continue
+		}
+
+		prefs, err := items.GetUser(user.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Cannot get leave of %s", user.Name)
+		}
+
+		if prefs.OnLeave(from, to) {
+			collected = append(collected, userItems{User: user, OnLeave: true})
+		}
+	}
+
+	return s, collected, nil
+}
+
+// Post fields as one attachment under the title rendered from the template
+func post(s *slack.Client, opts Options, titleTemplate string, data render.Data, fields []slack.AttachmentField) error {
+	title, err := opts.Templates.Render(titleTemplate, data)
+	if err != nil {
+		return err
+	}
+
+	color, err := opts.Templates.Render("color", data)
+	if err != nil {
+		return err
+	}
+
+	footer, err := opts.Templates.Render("footer", data)
+	if err != nil {
+		return err
+	}
+
+	params := slack.PostMessageParameters{}
+	params.Attachments = []slack.Attachment{
+		slack.Attachment{
+			Color:      color,
+			Fields:     fields,
+			Footer:     footer,
+			FooterIcon: "http://i.imgur.com/fLcxkel.png",
+		},
+	}
+
+	params.IconURL = "http://i.imgur.com/fLcxkel.png"
+	params.Username = "oshin"
+
+	_, _, err = s.PostMessage(opts.Channel, title, params)
+	return err
+}
+
+// Line of an item in the digest
+func renderItem(templates *render.Set, user slack.User, item store.Item) (string, error) {
+	return templates.Render("item", render.Data{
+		User:     user.Name,
+		Date:     item.CreatedAt.Format("2006-01-02"),
+		Text:     item.Text,
+		Kind:     kindOf(item),
+		Link:     item.Permalink(),
+		Status:   status(item),
+		Duration: render.Duration(item.Duration),
+		Tags:     item.Entities.Tags,
+		Mentions: item.Entities.Mentions,
+		Channels: item.Entities.Channels,
+		URLs:     item.Entities.URLs,
+		Issues:   item.Entities.Issues,
+	})
+}
+
+// Whether the working item was closed by one of the items
+func closedIn(item store.Item, items []store.Item) bool {
+	if item.ClosedBy == "" {
+		return false
+	}
+
+	for _, other := range items {
+		if other.ID == item.ClosedBy {
+			return true
+		}
+	}
+
+	return false
+}
+
+func status(item store.Item) string {
+	switch {
+	case item.Open(), item.Blocking():
+		return "open"
+	case item.Resolved != nil:
+		return "resolved"
+	case item.ClosedBy != "" || item.Closes != "":
+		return "done"
+	}
+
+	return ""
+}
+
+// Kind of an item, guessed for old items stored without one
+func kindOf(item store.Item) string {
+	if item.Kind == "" {
+		return store.GuessKind(item.Text)
+	}
+
+	return item.Kind
+}
@@ -0,0 +1,183 @@
+package digest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Periods of a digest
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+// Lines of each section of a person in a roll-up, the rest is only counted
+const rollupMaxLines = 10
+
+// Window returns the week or month of the day before at, in the location of at.
+// Weeks start on Monday. The window never ends after at.
+func Window(period string, at time.Time) (time.Time, time.Time) {
+	today := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	yesterday := today.AddDate(0, 0, -1)
+
+	var from, to time.Time
+	switch period {
+	case PeriodMonthly:
+		from = time.Date(yesterday.Year(), yesterday.Month(), 1, 0, 0, 0, 0, at.Location())
+		to = from.AddDate(0, 1, 0)
+	case PeriodWeekly:
+		offset := (int(yesterday.Weekday()) + 6) % 7
+		from = yesterday.AddDate(0, 0, -offset)
+		to = from.AddDate(0, 0, 7)
+	default:
+		from, to = yesterday, today
+	}
+
+	if to.After(at) {
+		to = at
+	}
+
+	return from, to
+}
+
+// Rollup returns a job which posts done items and TILs of everyone over the
+// week or month before it runs, with counts per person and per tag.
+func Rollup(items store.Store, period string, opts Options) func(at time.Time) {
+	return func(at time.Time) {
+		if h, ok := opts.Holidays.Holiday(at); ok {
+			log.Infof("No %s roll-up for %s on %s", period, opts.Channel, h.Name)
+			return
+		}
+
+		from, to := Window(period, at)
+
+		s, collected, err := collect(items, opts.BotToken, opts.Rule, from, to)
+		if err != nil {
+			log.Errorf("Cannot prepare %s roll-up for %s: %s", period, opts.Channel, err)
+			return
+		}
+
+		fields := []slack.AttachmentField{}
+		perPerson := []string{}
+		perTag := map[string]int{}
+
+		for _, u := range collected {
+			var done, learned []string
+			for _, item := range u.Items {
+				kind := kindOf(item)
+				if kind != store.KindDone && kind != store.KindTIL {
+					continue
+				}
+
+				line, err := renderItem(opts.Templates, u.User, item)
+				if err != nil {
+					log.Errorf("Cannot prepare %s roll-up for %s: %s", period, opts.Channel, err)
+					return
+				}
+
+				if kind == store.KindDone {
+					done = append(done, line)
+				} else {
+					learned = append(learned, line)
+				}
+
+				for _, tag := range item.Entities.Tags {
+					perTag[tag]++
+				}
+			}
+
+			if len(done)+len(learned) == 0 {
+				continue
+			}
+
+			values := []string{fmt.Sprintf("Done: *%d*, Learned: *%d*", len(done), len(learned))}
+			values = append(values, rollupSection("Done", done)...)
+			values = append(values, rollupSection("Learned", learned)...)
+
+			fields = append(fields, slack.AttachmentField{
+				Title: u.User.Name,
+				Value: strings.Join(values, "\n"),
+			})
+			perPerson = append(perPerson, fmt.Sprintf("%s: %d done, %d learned", u.User.Name, len(done), len(learned)))
+		}
+
+		if len(fields) == 0 {
+			return
+		}
+
+		summary := []slack.AttachmentField{
+			slack.AttachmentField{Title: "Per person", Value: strings.Join(perPerson, "\n")},
+		}
+		if len(perTag) > 0 {
+			summary = append(summary, slack.AttachmentField{Title: "Per tag", Value: strings.Join(countLines(perTag), "\n")})
+		}
+
+		data := render.Data{
+			Date:   from.Format("2006-01-02") + " - " + to.Add(-time.Nanosecond).Format("2006-01-02"),
+			Period: period,
+			Tags:   opts.Tags,
+			Count:  len(fields),
+			Counts: perTag,
+		}
+
+		if err := post(s, opts, "rollup_title", data, append(summary, fields...)); err != nil {
+			log.Errorf("Cannot post %s roll-up to %s: %s", period, opts.Channel, err)
+		}
+	}
+}
+
+// Title and lines of a section, cut at rollupMaxLines
+func rollupSection(title string, lines []string) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	values := []string{fmt.Sprintf("*%s*", title)}
+	if len(lines) > rollupMaxLines {
+		values = append(values, lines[:rollupMaxLines]...)
+		return append(values, fmt.Sprintf("_and %d more_", len(lines)-rollupMaxLines))
+	}
+
+	return append(values, lines...)
+}
+
+// "name: count" lines, highest count first
+func countLines(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Sort(byCount{names, counts})
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %d", name, counts[name]))
+	}
+
+	return lines
+}
+
+type byCount struct {
+	names  []string
+	counts map[string]int
+}
+
+func (b byCount) Len() int      { return len(b.names) }
+func (b byCount) Swap(i, j int) { b.names[i], b.names[j] = b.names[j], b.names[i] }
+func (b byCount) Less(i, j int) bool {
+	if b.counts[b.names[i]] != b.counts[b.names[j]] {
+		return b.counts[b.names[i]] > b.counts[b.names[j]]
+	}
+
+	return b.names[i] < b.names[j]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+const messageUsage = "on: <what you are going to do>`, `done: <what you have finished>`, `til: <what you have learned>` or `blocked: <what blocks you>"
+
+// Prefixes of messages to the bot, messages without one are working items
+var messageKinds = map[string]string{
+	"on":      store.KindWorking,
+	"working": store.KindWorking,
+	"done":    store.KindDone,
+	"til":     store.KindTIL,
+	"blocked": store.KindBlocked,
+}
+
+// Kind and text of a message to the bot, e.g. "done: fix login" is a done
+// item "fix login"
+func parseMessage(text string) (string, string) {
+	text = strings.TrimSpace(text)
+
+	if i := strings.Index(text, ":"); i > 0 {
+		if kind, ok := messageKinds[strings.ToLower(strings.TrimSpace(text[:i]))]; ok {
+			return kind, strings.TrimSpace(text[i+1:])
+		}
+	}
+
+	return store.KindWorking, text
+}
+
+// Listen to direct messages to the bot over RTM, they are items as the ones
+// of slash commands and the bot replies with the same confirmation.
+// Reactions to messages may make items too, see reactionAdded.
+// The connection is managed by the client, which reconnects when it drops.
+func startRTM(items store.ItemStore, settings *liveConfig, token string) *slack.RTM {
+	rtm := slack.New(token).NewRTM()
+	go rtm.ManageConnection()
+
+	go func() {
+		for event := range rtm.IncomingEvents {
+			switch ev := event.Data.(type) {
+			case *slack.ConnectedEvent:
+				log.Infof("Connected to Slack RTM as %s", ev.Info.User.Name)
+			case *slack.ConnectionErrorEvent:
+				log.Warnf("Cannot connect to Slack RTM: %s", ev.ErrorObj)
+			case *slack.InvalidAuthEvent:
+				log.Errorln("Cannot connect to Slack RTM: invalid token")
+				return
+			case *slack.MessageEvent:
+				directMessage(rtm, items, settings, ev)
+			case *slack.ReactionAddedEvent:
+				reactionAdded(items, settings.Load(), token, reaction{ev.User, ev.ItemUser, ev.Reaction, ev.Item.Channel, ev.Item.Timestamp})
+			case *slack.ReactionRemovedEvent:
+				reactionRemoved(items, settings.Load(), reaction{ev.User, ev.ItemUser, ev.Reaction, ev.Item.Channel, ev.Item.Timestamp})
+			}
+		}
+	}()
+
+	return rtm
+}
+
+// Store a direct message to the bot and reply in the conversation
+func directMessage(rtm *slack.RTM, items store.ItemStore, settings *liveConfig, ev *slack.MessageEvent) {
+	// Direct message channels start with D. Edits, joins, ... have a
+	// subtype, and the bot does not listen to itself or to other bots.
+	if !strings.HasPrefix(ev.Channel, "D") || ev.SubType != "" || ev.BotID != "" || ev.User == "" {
+		return
+	}
+	if info := rtm.GetInfo(); info != nil && info.User != nil && ev.User == info.User.ID {
+		return
+	}
+
+	user, err := rtm.GetUserInfo(ev.User)
+	if err != nil {
+		log.Errorf("Cannot get user %s: %s", ev.User, err)
+		return
+	}
+
+	message := receiveMessage(items, settings, user.ID, user.Name, ev.Text)
+	rtm.SendMessage(rtm.NewOutgoingMessage(message, ev.Channel))
+}
+
+// Store a message to the bot as an item, the reply tells the user how it went
+func receiveMessage(items store.ItemStore, settings *liveConfig, userID, userName, text string) string {
+	kind, text := parseMessage(text)
+
+	message, err := ingest(items, kind, text, userID, userName, settings.Load(), messageUsage)
+	return replyText(message, err, "Cannot add item of "+userName)
+}
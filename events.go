@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Request of the Events API, either the check of the request URL or an event
+type eventEnvelope struct {
+	Type      string     `json:"type"`
+	Challenge string     `json:"challenge"`
+	EventID   string     `json:"event_id"`
+	Event     slackEvent `json:"event"`
+}
+
+// Fields of message.im, app_mention, reaction_added and reaction_removed events
+type slackEvent struct {
+	Type        string `json:"type"`
+	SubType     string `json:"subtype"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+
+	// Reactions
+	Reaction string `json:"reaction"`
+	ItemUser string `json:"item_user"`
+	Item     struct {
+		Channel   string `json:"channel"`
+		Timestamp string `json:"ts"`
+	} `json:"item"`
+}
+
+// How long event ids are remembered, Slack retries for a few minutes
+const eventRetention = time.Hour
+
+// Mention of the bot at the start of a message, "<@U024BE7LH> done ..."
+var leadingMention = regexp.MustCompile(`^\s*<@[UW][A-Z0-9]+(\|[^>]*)?>[:,]?\s*`)
+
+// Ids of the events handled already. Slack delivers an event again when it
+// was not acknowledged in time, it must not be stored twice.
+type seenEvents struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func newSeenEvents() *seenEvents {
+	return &seenEvents{ids: map[string]time.Time{}}
+}
+
+// Add the id, false if it was there already
+func (s *seenEvents) add(id string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for seen, at := range s.ids {
+		if now.Sub(at) > eventRetention {
+			delete(s.ids, seen)
+		}
+	}
+
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+
+	s.ids[id] = now
+	return true
+}
+
+// Handle the Events API: direct messages to the bot and mentions of it are
+// items, as with RTM. Events are acknowledged at once and handled after,
+// Slack only waits 3 seconds.
+func slackEvents(items store.ItemStore, settings *liveConfig) func(c *gin.Context) {
+	seen := newSeenEvents()
+
+	return func(c *gin.Context) {
+		var envelope eventEnvelope
+		if err := json.NewDecoder(c.Request.Body).Decode(&envelope); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event"})
+			return
+		}
+
+		switch envelope.Type {
+		case "url_verification":
+			c.JSON(http.StatusOK, gin.H{"challenge": envelope.Challenge})
+			return
+		case "event_callback":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type"})
+			return
+		}
+
+		if envelope.EventID != "" && !seen.add(envelope.EventID, time.Now()) {
+			log.Infof("Skip event %s, it was handled already", envelope.EventID)
+			c.Status(http.StatusOK)
+			return
+		}
+
+		go handleEvent(items, settings, envelope.Event)
+		c.Status(http.StatusOK)
+	}
+}
+
+// Store the message of the event and reply to its author, in the
+// conversation for direct messages and only to them in channels.
+// Reactions to messages may make items too, see reactionAdded.
+func handleEvent(items store.ItemStore, settings *liveConfig, ev slackEvent) {
+	if ev.SubType != "" || ev.BotID != "" || ev.User == "" {
+		return
+	}
+
+	token := os.Getenv("BOT_TOKEN")
+
+	switch ev.Type {
+	case "reaction_added":
+		reactionAdded(items, settings.Load(), token, reaction{ev.User, ev.ItemUser, ev.Reaction, ev.Item.Channel, ev.Item.Timestamp})
+		return
+	case "reaction_removed":
+		reactionRemoved(items, settings.Load(), reaction{ev.User, ev.ItemUser, ev.Reaction, ev.Item.Channel, ev.Item.Timestamp})
+		return
+	}
+
+	direct := ev.Type == "message" && ev.ChannelType == "im"
+	if !direct && ev.Type != "app_mention" {
+		return
+	}
+
+	user, err := slack.New(token).GetUserInfo(ev.User)
+	if err != nil {
+		log.Errorf("Cannot get user %s: %s", ev.User, err)
+		return
+	}
+
+	message := receiveMessage(items, settings, user.ID, user.Name, leadingMention.ReplaceAllString(ev.Text, ""))
+
+	if direct {
+		_, err = bot.Post(token, ev.Channel, message, nil)
+	} else {
+		err = bot.Ephemeral(token, ev.Channel, ev.User, message)
+	}
+	if err != nil {
+		log.Errorf("Cannot reply to %s: %s", user.Name, err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeenEvents(t *testing.T) {
+	seen := newSeenEvents()
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		id   string
+		at   time.Time
+		add  bool
+	}{
+		{"first delivery", "Ev1", now, true},
+		{"retry", "Ev1", now.Add(time.Minute), false},
+		{"other event", "Ev2", now.Add(time.Minute), true},
+		{"retry of the other event", "Ev2", now.Add(2 * time.Minute), false},
+		{"after the retention", "Ev1", now.Add(eventRetention + time.Second), true},
+	}
+
+	for _, test := range tests {
+		if got := seen.add(test.id, test.at); got != test.add {
+			t.Errorf("%s: add(%q) = %v, want %v", test.name, test.id, got, test.add)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dwarvesf/working-on/digest"
+	"github.com/dwarvesf/working-on/nudge"
+	"github.com/dwarvesf/working-on/remind"
+	"github.com/dwarvesf/working-on/schedule"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Scheduled jobs of digest.json: digests, nudges and reminders. They are
+// replaced as a whole when the file is reloaded.
+type digestJobs struct {
+	mu        sync.Mutex
+	items     store.Store
+	reminders *remind.Runner
+
+	jobs []*schedule.Job
+	keys []string
+
+	// Location of the first digest, the days of `/working search` are its days
+	location *time.Location
+}
+
+// Stop the jobs of the previous configuration and start the ones of c
+func (d *digestJobs) apply(c *Configuration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, job := range d.jobs {
+		job.Stop()
+	}
+	for _, key := range d.keys {
+		d.reminders.Stop(key)
+	}
+	d.jobs, d.keys = nil, nil
+
+	d.location = time.UTC
+	if len(c.Items) > 0 {
+		if location, err := schedule.LoadLocation(c.Items[0].Timezone); err == nil {
+			d.location = location
+		}
+	}
+
+	// Each digest at its own time and timezone
+	for _, i := range c.Items {
+		when, weekdays, err := digestSchedule(i)
+		if err != nil {
+			log.Errorf("Invalid digest schedule for %s: %s", i.Channel, err)
+			continue
+		}
+
+		opts := digest.Options{
+			Channel:   i.Channel,
+			BotToken:  i.token,
+			Tags:      i.Tags,
+			Rule:      i.rule,
+			Templates: i.templates,
+			Weekdays:  weekdays,
+			Holidays:  i.holidays,
+		}
+
+		job := digest.Daily(d.items, opts)
+		if i.Period == digest.PeriodWeekly || i.Period == digest.PeriodMonthly {
+			job = digest.Rollup(d.items, i.Period, opts)
+		}
+		d.jobs = append(d.jobs, schedule.Run(when, job))
+
+		if i.Nudge != nil {
+			d.scheduleNudge(i)
+		}
+	}
+
+	d.reminders.SetHolidays(c.holidays)
+	for n, reminder := range c.Reminders {
+		key := fmt.Sprintf("config-%d", n+1)
+		if err := d.reminders.Start(key, reminder, reminderToken(reminder)); err != nil {
+			log.Errorf("Invalid reminder %d: %s", n+1, err)
+			continue
+		}
+		d.keys = append(d.keys, key)
+	}
+}
+
+// Location of the days of the digests
+func (d *digestJobs) Location() *time.Location {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.location == nil {
+		return time.UTC
+	}
+
+	return d.location
+}
+
+// Setup the nudge job of a digest entry, its team is the one of the token
+func (d *digestJobs) scheduleNudge(i ConfigurationItem) {
+	when, err := nudgeSchedule(i)
+	if err != nil {
+		log.Errorf("Invalid nudge schedule for %s: %s", i.Channel, err)
+		return
+	}
+
+	d.jobs = append(d.jobs, schedule.Run(when, nudge.Job(d.items, nudge.Options{
+		BotToken:  i.token,
+		Templates: i.templates,
+		Holidays:  i.holidays,
+	})))
+}
+
+// Schedule of a digest entry, and the weekdays of a daily digest
+func digestSchedule(i ConfigurationItem) (schedule.Schedule, []time.Weekday, error) {
+	at := i.Time
+	if at == "" {
+		at = os.Getenv("DIGEST_TIME")
+	}
+
+	switch i.Period {
+	case "", digest.PeriodDaily:
+		daily, err := schedule.NewDaily(at, i.Timezone, i.Weekdays)
+		return daily, daily.Weekdays, err
+	case digest.PeriodWeekly:
+		weekdays := i.Weekdays
+		if len(weekdays) == 0 {
+			weekdays = []string{"fri"}
+		}
+
+		weekly, err := schedule.NewDaily(at, i.Timezone, weekdays)
+		return weekly, nil, err
+	case digest.PeriodMonthly:
+		monthly, err := schedule.NewMonthly(i.MonthDay, at, i.Timezone)
+		return monthly, nil, err
+	}
+
+	return nil, nil, fmt.Errorf("Unknown period %q", i.Period)
+}
+
+// Schedule of the nudge of a digest entry, timezone and weekdays default to
+// the ones of the entry
+func nudgeSchedule(i ConfigurationItem) (schedule.Schedule, error) {
+	timezone := i.Nudge.Timezone
+	if timezone == "" {
+		timezone = i.Timezone
+	}
+
+	weekdays := i.Nudge.Weekdays
+	if len(weekdays) == 0 {
+		weekdays = i.Weekdays
+	}
+
+	return schedule.NewDaily(i.Nudge.Time, timezone, weekdays)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dwarvesf/working-on/calendar"
+	"github.com/dwarvesf/working-on/store"
+)
+
+const offUsage = "Usage: `/working off <YYYY-MM-DD>[..<YYYY-MM-DD>]`, `/working off cancel <YYYY-MM-DD>` or `/working off` to list your leave"
+
+// Handle `/working off`: declare, cancel or list days off
+func setLeave(users store.UserStore, userID, userName, text string) (string, error) {
+	user, err := users.GetUser(userID)
+	if err != nil {
+		return "", err
+	}
+
+	command, args := splitCommand(text)
+	switch command {
+	case "":
+		return listLeave(user), nil
+	case "cancel":
+		return cancelLeave(users, user, args)
+	}
+
+	from, to, err := calendar.ParseRange(text)
+	if err != nil {
+		return "", commandError(fmt.Sprintf("%s.\n%s", err, offUsage))
+	}
+
+	user.Name = userName
+	user.Leaves = append(user.Leaves, store.Leave{From: from, To: to})
+	if err := users.SaveUser(user); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Enjoy your time off! You are on leave %s.", leaveDays(store.Leave{From: from, To: to})), nil
+}
+
+// Upcoming and current leave of the user
+func listLeave(user *store.User) string {
+	today := time.Now().Format(calendar.Day)
+
+	var lines []string
+	for _, leave := range user.Leaves {
+		if leave.To >= today {
+			lines = append(lines, "+ "+leaveDays(leave))
+		}
+	}
+
+	if len(lines) == 0 {
+		return "You have no leave coming.\n" + offUsage
+	}
+
+	return "Your leave:\n" + strings.Join(lines, "\n")
+}
+
+// Remove the leave which includes the day
+func cancelLeave(users store.UserStore, user *store.User, day string) (string, error) {
+	from, to, err := calendar.ParseRange(day)
+	if err != nil || from != to {
+		return "", commandError(offUsage)
+	}
+
+	var kept []store.Leave
+	var cancelled *store.Leave
+	for i, leave := range user.Leaves {
+		if cancelled == nil && leave.From <= day && day <= leave.To {
+			cancelled = &user.Leaves[i]
+			continue
+		}
+		kept = append(kept, leave)
+	}
+
+	if cancelled == nil {
+		return "", commandError(fmt.Sprintf("You are not on leave on %s.", day))
+	}
+
+	user.Leaves = kept
+	if err := users.SaveUser(user); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Cancelled your leave %s.", leaveDays(*cancelled)), nil
+}
+
+func leaveDays(leave store.Leave) string {
+	if leave.From == leave.To {
+		return "on " + leave.From
+	}
+
+	return fmt.Sprintf("from %s to %s", leave.From, leave.To)
+}
@@ -1,129 +1,220 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	arrow "github.com/bmuller/arrow/lib"
 	gorelic "github.com/brandfolder/gin-gorelic"
-	"github.com/carlescere/scheduler"
 	"github.com/gin-gonic/contrib/ginrus"
 	"github.com/gin-gonic/gin"
 	"github.com/nlopes/slack"
 	"gopkg.in/mgo.v2/bson"
 
-	"github.com/dwarvesf/working-on/db"
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/middleware"
+	"github.com/dwarvesf/working-on/remind"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/secret"
+	"github.com/dwarvesf/working-on/store"
 )
 
-type Item struct {
-	ID        bson.ObjectId `json:"id" bson:"_id"`
-	UserID    string        `json:"user_id" bson:"user_id"`
-	Name      string        `json:"user_name" bson:"user_name"`
-	Text      string        `json:"text" bson:"text"`
-	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
-}
-
 func main() {
 
 	// Read configuration from file and env
 	port := os.Getenv("PORT")
-	digestTime := os.Getenv("DIGEST_TIME")
-	dailyScrumTime := os.Getenv("DAILYSCRUM_TIME")
 	gorelic.InitNewrelicAgent(os.Getenv("NEW_RELIC_LICENSE_KEY"), "working", false)
 
-	digestConfig, err := parseConfig("digest.json")
+	items, err := store.New(os.Getenv("STORE"))
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	// Setup schedule digest jobs
-	for _, i := range digestConfig.Items {
-		digestJob := postDigest(i.Channel, os.Getenv(i.Token), i.Tags)
-		_, err := scheduler.Every().Day().At(digestTime).Run(digestJob)
+	// Items created before kinds were stored need one
+	if mongo, ok := items.(*store.MongoStore); ok {
+		count, err := mongo.BackfillKind()
 		if err != nil {
-			log.Infoln(err)
+			log.Errorln(err)
+		}
+		if count > 0 {
+			log.Infof("Backfilled kind for %d items", count)
 		}
 	}
 
-	// Setup schedule for daily scrum reminer
-	scheduler.Every().Day().At(dailyScrumTime).Run(remindDailyScrum)
+	// Items stored before their entities were parsed need them
+	if backfiller, ok := items.(interface {
+		BackfillEntities() (int, error)
+	}); ok {
+		count, err := backfiller.BackfillEntities()
+		if err != nil {
+			log.Errorln(err)
+		}
+		if count > 0 {
+			log.Infof("Backfilled entities for %d items", count)
+		}
+	}
 
-	settingConfig, err := parseConfig("setting.json")
+	digestConfig, err := parseConfig("digest.json", digestFile)
 	if err != nil {
-		log.Fatalln(err)
+		logConfigError(err)
+		os.Exit(1)
+	}
+
+	// Reminders added with `/working remind add`, the ones of digest.json
+	// start with its digests
+	reminders := remind.NewRunner(nil)
+	startReminders(reminders, items)
+
+	jobs := &digestJobs{items: items, reminders: reminders}
+	jobs.apply(digestConfig)
+	watchConfig("digest.json", digestFile, digestConfig, jobs.apply)
+
+	settingConfig, err := parseConfig("setting.json", settingFile)
+	if err != nil {
+		logConfigError(err)
+		os.Exit(1)
+	}
+
+	settings := newLiveConfig(settingConfig)
+	watchConfig("setting.json", settingFile, settingConfig, settings.Store)
+
+	// Direct messages to the bot are items too
+	var rtm *slack.RTM
+	if os.Getenv("RTM") == "true" {
+		rtm = startRTM(items, settings, os.Getenv("BOT_TOKEN"))
 	}
 
 	// Prepare router
 	router := gin.New()
+	router.Use(gin.Recovery())
 	router.Use(gorelic.Handler)
 	router.Use(ginrus.Ginrus(log.StandardLogger(), time.RFC3339, true))
 
 	// router.LoadHTMLGlob("templates/*.tmpl.html")
 	router.Static("/static", "static")
-	router.POST("/on", on(*settingConfig))
-	router.POST("/til", til(*settingConfig))
-	router.POST("/done", done(*settingConfig))
 
-	// Start server
-	router.Run(":" + port)
-}
+	// Slash commands must come from Slack
+	slash := router.Group("/", middleware.VerifySlack(os.Getenv("SLASH_TOKEN"), os.Getenv("SLACK_SIGNING_SECRET")))
+	slash.POST("/on", on(items, settings))
+	slash.POST("/til", til(items, settings))
+	slash.POST("/done", done(items, settings))
+	slash.POST("/working", working(items, settings, reminders, jobs))
+	slash.POST("/blocked", blocked(items, settings))
+	slash.POST("/unblocked", unblocked(items, settings))
 
-func done(config Configuration) func(c *gin.Context) {
-	return func(c *gin.Context) {
+	// Buttons of interactive messages
+	slash.POST("/slack/actions", itemActions(items, settings, jobs))
 
-		text := c.PostForm("text")
-		text = strings.TrimSpace(text)
+	// Direct messages and mentions through the Events API, instead of RTM
+	slash.POST("/slack/events", slackEvents(items, settings))
 
-		if text == "" {
-			log.Fatalln("Message is nil")
-			return
+	// Start server
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln(err)
 		}
+	}()
 
-		userID := c.PostForm("user_id")
-		userName := c.PostForm("user_name")
+	// Finish in-flight requests and release the database on shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
 
-		addItem(text, userID, userName, config, ":cantboiroi: *%s* has *done*: %s")
+	log.Infoln("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Errorln(err)
 	}
-}
 
-func til(config Configuration) func(c *gin.Context) {
-	return func(c *gin.Context) {
-		text := c.PostForm("text")
-		text = strings.TrimSpace(text)
+	if rtm != nil {
+		rtm.Disconnect()
+	}
 
-		if text == "" {
-			log.Fatalln("Message is nil")
-			return
-		}
+	if err := items.Close(); err != nil {
+		log.Errorln(err)
+	}
+}
 
-		userID := c.PostForm("user_id")
-		userName := c.PostForm("user_name")
+func done(items store.ItemStore, settings *liveConfig) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		handleCommand(c, items, store.KindDone, c.PostForm("text"), settings.Load(), "/done <what you have finished>")
+	}
+}
 
-		addItem(text, userID, userName, config, "*%s* #til - Today I learned: %s :adore:")
+func til(items store.ItemStore, settings *liveConfig) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		handleCommand(c, items, store.KindTIL, c.PostForm("text"), settings.Load(), "/til <what you have learned>")
 	}
 }
 
-func on(config Configuration) func(c *gin.Context) {
+func on(items store.ItemStore, settings *liveConfig) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		text := c.PostForm("text")
-		text = strings.TrimSpace(text)
+		handleCommand(c, items, store.KindWorking, c.PostForm("text"), settings.Load(), "/on <what you are going to do>")
+	}
+}
+
+// Response of a slash command, ephemeral ones are only shown to the user
+type slackResponse struct {
+	ResponseType string             `json:"response_type"`
+	Text         string             `json:"text"`
+	Attachments  []slack.Attachment `json:"attachments,omitempty"`
+}
+
+// Reply to the user who issued the command only. Always with status 200,
+// Slack drops the body of other statuses and shows its own error instead.
+func respondEphemeral(c *gin.Context, text string) {
+	c.JSON(http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: text})
+}
+
+// Store the item from a slash command and tell the user how it went.
+// Errors are only reported back to the user, they never stop the server.
+func handleCommand(c *gin.Context, items store.ItemStore, kind string, text string, config Configuration, usage string) {
+	userName := c.PostForm("user_name")
+
+	message, err := ingest(items, kind, text, c.PostForm("user_id"), userName, config, usage)
+	respondEphemeral(c, replyText(message, err, "Cannot add item of "+userName))
+}
+
+// Store the item of a slash command or of a message to the bot, the
+// message tells the user what was saved
+func ingest(items store.ItemStore, kind, text, userID, userName string, config Configuration, usage string) (string, error) {
+	text = strings.TrimSpace(text)
+
+	if text == "" {
+		return "", commandError(fmt.Sprintf("Please tell me what it is. Usage: `%s`", usage))
+	}
+
+	// Done items may close a working item
+	if kind == store.KindDone {
+		item, task, err := addDone(items, text, userID, userName, config)
+		if err != nil {
+			return "", err
+		}
 
-		if text == "" {
-			log.Fatalln("Message is nil")
-			return
+		if task != nil {
+			return fmt.Sprintf("Saved :ok_hand: (id `%s`), closes `%s` after %s",
+				item.ID.Hex(), task.ID.Hex(), render.Duration(item.Duration)), nil
 		}
 
-		userID := c.PostForm("user_id")
-		userName := c.PostForm("user_name")
+		return fmt.Sprintf("Saved :ok_hand: (id `%s`)", item.ID.Hex()), nil
+	}
 
-		addItem(text, userID, userName, config, "*%s* is *working* on: %s")
+	item, err := addItem(items, text, userID, userName, kind, config)
+	if err != nil {
+		return "", err
 	}
+
+	return fmt.Sprintf("Saved :ok_hand: (id `%s`)", item.ID.Hex()), nil
 }
 
 // Message will be passed to server with '-' prefix via various way
@@ -133,236 +224,146 @@ func on(config Configuration) func(c *gin.Context) {
 //	+ Might use Chrome plugin
 //	+ ...
 // Token is secondary param to indicate the user
-func addItem(text string, userID string, userName string, configuration Configuration, format string) {
+func addItem(items store.ItemStore, text string, userID string, userName string, kind string, configuration Configuration) (*store.Item, error) {
+	item := newItem(text, userID, userName, kind)
+
+	if err := saveItem(items, &item, nil, configuration); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
 
+func newItem(text string, userID string, userName string, kind string) store.Item {
 	// Parse token and message
-	var item Item
+	var item store.Item
 
 	item.ID = bson.NewObjectId()
 	item.CreatedAt = time.Now()
 	item.Name = userName
 	item.UserID = userID
-	item.Text = text
+	item.SetText(text)
+	item.Kind = kind
 
-	ctx, err := db.NewContext()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	defer ctx.Close()
+	return item
+}
 
-	// Add Item to database
-	err = ctx.C("items").Insert(item)
-	if err != nil {
-		log.Fatalln(err)
-	}
+// Store the item and repost it.
+// Items following up a parent are posted in the threads of its reposts.
+func saveItem(items store.ItemStore, item *store.Item, parent *store.Item, configuration Configuration) error {
 
 	// Repost to the target channel
 	channel := os.Getenv("WORKING_CHANNEL")
 	botToken := os.Getenv("BOT_TOKEN")
 
 	if botToken == "" {
-		log.Fatal("No token provided")
+		return errors.New("No token provided")
 	}
 
-	// <@U024BE7LH|bob>: format text to match Slack format
-	userName = fmt.Sprintf("<@%s|%s>", userID, userName)
-	title := fmt.Sprintf(format, userName, text)
+	// Add Item to database
+	err := items.Insert(item)
+	if err != nil {
+		return err
+	}
 
-	postItem(botToken, channel, title)
+	data := itemData(configuration, item)
 
-	// Post item to project group
-	for _, config := range configuration.Items {
-		for _, tag := range config.Tags {
-			if strings.Contains(text, tag) {
-				log.Infof("Hit %s", tag)
-				log.Infof("Token: %s", config.Token)
-
-				// Post to target channel
-				postItem(config.Token, config.Channel, title)
-			}
-		}
+	if parent != nil && len(parent.Posts) > 0 {
+		replyItem(items, item, parent, configuration)
+		return nil
 	}
-}
 
-func postItem(token string, channel string, text string) {
-	s := slack.New(token)
-	params := slack.PostMessageParameters{}
-	params.IconURL = "http://i.imgur.com/fLcxkel.png"
-	params.Username = "oshin"
-	s.PostMessage(channel, text, params)
-}
-
-type Configuration struct {
-	Items []ConfigurationItem `json:"items"`
-}
+	// The item is saved already, failing reposts are only logged
+	title, err := configuration.templates.Render(item.Kind, data)
+	if err == nil {
+		err = postItem(item, botToken, channel, title)
+	}
+	if err != nil {
+		log.Errorf("Cannot post item to %s: %s", channel, err)
+	}
 
-type ConfigurationItem struct {
-	Channel string   `json:"channel"`
-	Tags    []string `json:"tags"`
-	Token   string   `json:"token"`
-}
+	// Post item to project group, once per channel of each team
+	posted := map[string]bool{botToken + channel: true}
+	for _, config := range configuration.Items {
+		if config.rule == nil || !config.rule.Match(*item) {
+			continue
+		}
 
-func parseConfig(path string) (*Configuration, error) {
-	var configuration Configuration
+		if posted[config.token+config.Channel] {
+			continue
+		}
+		posted[config.token+config.Channel] = true
 
-	// Parse configuration
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, errors.New("Cannot read setting file")
-	}
+		log.Infof("Hit %s", config.rule)
+		log.Infof("Token: %s", secret.Redact(config.token))
 
-	err = json.Unmarshal(bytes, &configuration)
-	if err != nil {
-		return nil, errors.New("Cannot parse setting")
+		// Post to target channel
+		title, err := config.templates.Render(item.Kind, data)
+		if err == nil {
+			err = postItem(item, config.token, config.Channel, title)
+		}
+		if err != nil {
+			log.Errorf("Cannot post item to %s: %s", config.Channel, err)
+		}
 	}
 
-	return &configuration, nil
+	savePosts(items, item)
+	return nil
 }
 
-// Remind daily scrum by posting message to Slack
-func remindDailyScrum() {
-
-	today := arrow.Now().Weekday()
-	if today == time.Sunday || today == time.Saturday {
-		log.Infoln("It's weekend and people goes party!")
+// Remember the reposts so they can be edited or deleted later
+func savePosts(items store.ItemStore, item *store.Item) {
+	if len(item.Posts) == 0 {
 		return
 	}
 
-	botToken := os.Getenv("BOT_TOKEN")
-	url := os.Getenv("DAILYSCRUM_URL")
-
-	if botToken == "" || url == "" {
-		log.Fatal("No token provided")
-		os.Exit(1)
+	if err := items.Update(item, "posts"); err != nil {
+		log.Errorf("Cannot save posts of item %s: %s", item.ID.Hex(), err)
 	}
-
-	s := slack.New(botToken)
-
-	params := slack.PostMessageParameters{}
-	params.IconURL = "http://i.imgur.com/fLcxkel.png"
-	params.Username = "oshin"
-
-	text := "Đến giờ daily scrum rồi mấy bé <!here|here> " + url + " :4head:"
-	channel := "#random"
-
-	s.PostMessage(channel, text, params)
 }
 
-// Post summary to Slack channel.
-// Only post to specific channel when tags are met.
-func postDigest(channel, botToken string, tags []string) func() {
-	return func() {
-		if botToken == "" {
-			log.Fatal("No token provided")
-			os.Exit(1)
-		}
-
-		s := slack.New(botToken)
-		users, err := s.GetUsers()
-
-		if err != nil {
-			log.Fatal("Cannot get users")
-			os.Exit(1)
-		}
-
-		ctx, err := db.NewContext()
-		if err != nil {
-			log.Fatal(err)
-		}
+// Variables of the repost templates
+func itemData(config Configuration, item *store.Item) render.Data {
+	data := render.Data{
+		// <@U024BE7LH|bob>: format text to match Slack format
+		User: fmt.Sprintf("<@%s|%s>", item.UserID, item.Name),
+		Date: item.CreatedAt.Format("2006-01-02"),
+		Text: item.Text,
+		Kind: item.Kind,
+		Tags: item.Entities.Tags,
+
+		Mentions: item.Entities.Mentions,
+		Channels: item.Entities.Channels,
+		URLs:     item.Entities.URLs,
+		Issues:   item.Entities.Issues,
+
+		Duration: render.Duration(item.Duration),
+		Estimate: render.Duration(item.Estimate),
+		Blockers: item.Blockers,
+	}
 
-		defer ctx.Close()
-
-		log.Info("Preparing data")
-		// If count > 0, it means there is data to show
-		count := 0
-		params := slack.PostMessageParameters{}
-		fields := []slack.AttachmentField{}
-
-		yesterday := arrow.Yesterday().UTC()
-		toDate := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, time.UTC)
-
-		title := fmt.Sprintf(" :rocket: >> Team daily digest for *%s* :rocket: <!channel>", arrow.Yesterday().CFormat("%Y-%m-%d"))
-
-		// Prepare attachment of done items
-		for _, user := range users {
-
-			if user.IsBot || user.Deleted {
-				continue
-			}
-
-			// log.Infof("Process user: %s - %s", user.Name, user.Id)
-
-			// Query done items from Database
-			var values []string
-			var items []Item
-
-			err = ctx.C("items").Find(
-				bson.M{
-					"$and": []bson.M{
-						bson.M{"user_name": user.Name},
-						bson.M{"created_at": bson.M{"$gt": toDate}},
-					},
-				}).All(&items)
-
-			if err != nil {
-				log.Fatal("Cannot query done items.")
-				os.Exit(1)
-			}
-
-			for _, item := range items {
-				log.Infof("User: %s, item: %s, tags: %+v", user.Name, item.Text, tags)
-
-				// delete items which text does not contain tags
-				if tags != nil {
-					// check if item contains any tags
-					var containTag bool
-					for _, tag := range tags {
-						if !strings.Contains(item.Text, tag) {
-							continue
-						}
-						containTag = true
-						break
-					}
-
-					// if item.Text doesn't contains any tags then don't
-					// add it to the digest message (values)
-					if !containTag {
-						continue
-					}
-				}
-
-				// construct text format
-				values = append(values, fmt.Sprintf("+ %s", item.Text))
-			}
-
-			// <@U024BE7LH|bob>
-			if len(values) > 0 {
-				count++
-				field := slack.AttachmentField{
-					// Title: fmt.Sprintf("<@%s|%s>", user.ID, user.Name),
-					Title: fmt.Sprintf("%s", user.Name),
-					Value: strings.Join(values, "\n"),
-				}
-
-				fields = append(fields, field)
-			}
-		}
+	// Items made from a message link back to it
+	if item.Source != nil {
+		data.Link = item.Source.Permalink
+	}
 
-		params.Attachments = []slack.Attachment{
-			slack.Attachment{
-				Color:      "#7CD197",
-				Fields:     fields,
-				Footer:     "Oshin Bot",
-				FooterIcon: "http://i.imgur.com/fLcxkel.png",
-			},
-		}
+	if item.Kind == store.KindBlocked {
+		data.Leads = leadsOf(config, item)
+	}
+	if item.Resolved != nil {
+		data.ResolvedBy = fmt.Sprintf("<@%s|%s>", item.Resolved.UserID, item.Resolved.Name)
+	}
 
-		params.IconURL = "http://i.imgur.com/fLcxkel.png"
-		params.Username = "oshin"
+	return data
+}
 
-		if count > 0 {
-			s.PostMessage(channel, title, params)
-		}
+// Post the item to the channel and record the post on it
+func postItem(item *store.Item, token string, channel string, text string) error {
+	post, err := bot.Post(token, channel, text, itemAttachments(item))
+	if err != nil {
+		return err
 	}
+
+	item.Posts = append(item.Posts, post)
+	return nil
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/route"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Web API call received by the fake Slack
+type slackCall struct {
+	method string
+	values url.Values
+}
+
+// Fake Slack Web API. Every method succeeds, messages get the next
+// timestamp and responses of some methods can be set.
+type fakeSlack struct {
+	server *httptest.Server
+	api    string
+
+	mu        sync.Mutex
+	calls     []slackCall
+	responses map[string]string
+	ts        int
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{responses: map[string]string{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	f.api = slack.SLACK_API
+	slack.SLACK_API = f.server.URL + "/"
+
+	os.Setenv("BOT_TOKEN", "xoxb-test")
+	os.Setenv("WORKING_CHANNEL", "#working")
+
+	return f
+}
+
+func (f *fakeSlack) Close() {
+	slack.SLACK_API = f.api
+	f.server.Close()
+	os.Unsetenv("BOT_TOKEN")
+	os.Unsetenv("WORKING_CHANNEL")
+}
+
+func (f *fakeSlack) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := strings.TrimPrefix(r.URL.Path, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, slackCall{method, r.Form})
+
+	if response, ok := f.responses[method]; ok {
+		fmt.Fprint(w, response)
+		return
+	}
+
+	f.ts++
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":      true,
+		"channel": r.Form.Get("channel"),
+		"ts":      fmt.Sprintf("1476601200.%06d", f.ts),
+		"team_id": "T1",
+		"user_id": "UBOT",
+		"url":     "https://team.slack.com/",
+	})
+}
+
+// Set the response of a method
+func (f *fakeSlack) respond(method, response string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses[method] = response
+}
+
+// Calls of a method, oldest first
+func (f *fakeSlack) called(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var values []url.Values
+	for _, call := range f.calls {
+		if call.method == method {
+			values = append(values, call.values)
+		}
+	}
+
+	return values
+}
+
+// Configuration with the default templates and the items
+func testConfig(items ...ConfigurationItem) Configuration {
+	for i := range items {
+		items[i].templates = render.Default()
+	}
+
+	return Configuration{Items: items, templates: render.Default()}
+}
+
+func TestSaveItemPostsOncePerChannel(t *testing.T) {
+	slack := newFakeSlack(t)
+	defer slack.Close()
+
+	deploy, err := route.Parse("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := testConfig(
+		ConfigurationItem{Channel: "#classify", token: "xoxb-test", rule: route.Tags([]string{"#classify"})},
+		ConfigurationItem{Channel: "#classify", token: "xoxb-test", rule: deploy},
+		ConfigurationItem{Channel: "#classify", token: "xoxb-other", rule: deploy},
+		ConfigurationItem{Channel: "#working", token: "xoxb-test", rule: deploy},
+		ConfigurationItem{Channel: "#clipchute", token: "xoxb-test", rule: route.Tags([]string{"#clipchute"})},
+	)
+
+	items := store.NewMemoryStore()
+	item := newItem("Deploy the #classify API", "U1", "bob", store.KindWorking)
+	if err := saveItem(items, &item, nil, config); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := map[string]int{}
+	for _, values := range slack.called("chat.postMessage") {
+		posts[values.Get("token")+" "+values.Get("channel")]++
+	}
+
+	want := map[string]int{"xoxb-test #working": 1, "xoxb-test #classify": 1, "xoxb-other #classify": 1}
+	if len(posts) != len(want) {
+		t.Errorf("posts: got %v, want %v", posts, want)
+	}
+	for channel, n := range want {
+		if posts[channel] != n {
+			t.Errorf("posts to %s: got %d, want %d", channel, posts[channel], n)
+		}
+	}
+	if len(item.Posts) != 3 {
+		t.Errorf("posts of the item: got %d, want 3", len(item.Posts))
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// MaxRequestAge is how old a signed request can be before it is treated as a replay
+const MaxRequestAge = 5 * time.Minute
+
+const (
+	signatureHeader = "X-Slack-Signature"
+	timestampHeader = "X-Slack-Request-Timestamp"
+	signaturePrefix = "v0="
+)
+
+var (
+	ErrNoCredential     = errors.New("No verification token or signing secret configured")
+	ErrMissingSignature = errors.New("Missing Slack signature")
+	ErrBadTimestamp     = errors.New("Invalid Slack request timestamp")
+	ErrExpiredRequest   = errors.New("Slack request is too old")
+	ErrBadSignature     = errors.New("Slack signature does not match")
+	ErrBadToken         = errors.New("Slack verification token does not match")
+)
+
+// VerifySlack returns a middleware which only lets through requests coming from Slack.
+// When signingSecret is set, requests must carry a valid X-Slack-Signature.
+// Otherwise the legacy verification token in the `token` form field is compared with token.
+func VerifySlack(token, signingSecret string) gin.HandlerFunc {
+	if token == "" && signingSecret == "" {
+		log.Warnln(ErrNoCredential)
+	}
+
+	return func(c *gin.Context) {
+		err := verifyRequest(c.Request, token, signingSecret, time.Now())
+		if err != nil {
+			log.Warnf("Reject request to %s from %s: %s", c.Request.URL.Path, c.ClientIP(), err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func verifyRequest(r *http.Request, token, signingSecret string, now time.Time) error {
+	// Read the raw body for the signature then put it back for the handlers
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// With a signing secret the token is not enough, it could be used to
+	// skip the signature
+	switch {
+	case signingSecret != "":
+		return VerifySignature(signingSecret, r.Header.Get(timestampHeader), r.Header.Get(signatureHeader), body, now)
+	case token != "":
+		return VerifyToken(token, requestToken(r, body))
+	}
+
+	return ErrNoCredential
+}
+
+// Token of a slash command, of an interactive message which sends it in its
+// JSON payload, or of an event which is JSON
+func requestToken(r *http.Request, body []byte) string {
+	var payload struct {
+		Token string `json:"token"`
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		json.Unmarshal(body, &payload)
+		return payload.Token
+	}
+
+	if token := r.PostFormValue("token"); token != "" {
+		return token
+	}
+
+	json.Unmarshal([]byte(r.PostFormValue("payload")), &payload)
+
+	return payload.Token
+}
+
+// VerifySignature checks a Slack v0 request signature over timestamp and body
+func VerifySignature(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	if signature == "" || !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadTimestamp
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > MaxRequestAge || age < -MaxRequestAge {
+		return ErrExpiredRequest
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return ErrBadSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// VerifyToken compares the legacy verification token sent by Slack
+func VerifyToken(expected, actual string) error {
+	if actual == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return ErrBadToken
+	}
+
+	return nil
+}
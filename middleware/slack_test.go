@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1531420618, 0)
+	body := []byte("token=xyz&team_id=T1DC2JH3J&command=%2Fworking&text=docs")
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-MaxRequestAge-time.Second).Unix(), 10)
+	future := strconv.FormatInt(now.Add(MaxRequestAge+time.Second).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		err       error
+	}{
+		{"valid", timestamp, sign("secret", timestamp, body), body, nil},
+		{"a little old", "1531420418", sign("secret", "1531420418", body), body, nil},
+		{"expired", old, sign("secret", old, body), body, ErrExpiredRequest},
+		{"from the future", future, sign("secret", future, body), body, ErrExpiredRequest},
+		{"other secret", timestamp, sign("other", timestamp, body), body, ErrBadSignature},
+		{"other body", timestamp, sign("secret", timestamp, body), []byte("token=xyz"), ErrBadSignature},
+		{"other timestamp", "1531420619", sign("secret", timestamp, body), body, ErrBadSignature},
+		{"not hex", timestamp, "v0=zz", body, ErrBadSignature},
+		{"no prefix", timestamp, sign("secret", timestamp, body)[len(signaturePrefix):], body, ErrMissingSignature},
+		{"no signature", timestamp, "", body, ErrMissingSignature},
+		{"bad timestamp", "yesterday", sign("secret", "yesterday", body), body, ErrBadTimestamp},
+	}
+
+	for _, test := range tests {
+		err := VerifySignature("secret", test.timestamp, test.signature, test.body, now)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	tests := []struct {
+		actual string
+		err    error
+	}{
+		{"xyz", nil},
+		{"xy", ErrBadToken},
+		{"XYZ", ErrBadToken},
+		{"", ErrBadToken},
+	}
+
+	for _, test := range tests {
+		if err := VerifyToken("xyz", test.actual); err != test.err {
+			t.Errorf("VerifyToken(%q): got %v, want %v", test.actual, err, test.err)
+		}
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Unix(1531420618, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := "token=xyz&command=%2Fworking&text=docs"
+
+	tests := []struct {
+		name          string
+		token, secret string
+		signature     string
+		err           error
+	}{
+		{"token", "xyz", "", "", nil},
+		{"other token", "abc", "", "", ErrBadToken},
+		{"signature", "", "secret", sign("secret", timestamp, []byte(body)), nil},
+		{"signature and token", "xyz", "secret", sign("secret", timestamp, []byte(body)), nil},
+		{"bad signature and good token", "xyz", "secret", sign("other", timestamp, []byte(body)), ErrBadSignature},
+		{"only the token with a secret", "xyz", "secret", "", ErrMissingSignature},
+		{"nothing configured", "", "", "", ErrNoCredential},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/working", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set(timestampHeader, timestamp)
+		if test.signature != "" {
+			r.Header.Set(signatureHeader, test.signature)
+		}
+
+		if err := verifyRequest(r, test.token, test.secret, now); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
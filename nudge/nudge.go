@@ -0,0 +1,140 @@
+package nudge
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/calendar"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Options of a nudge job
+type Options struct {
+	BotToken string
+
+	// Templates of the nudge message
+	Templates *render.Set
+
+	// Holidays of the team, nobody is nudged on them
+	Holidays *calendar.Calendar
+}
+
+// Job returns a job which sends a direct message to every active user of the
+// team who has no item since the start of the day, in the location of the time
+// the job runs at. Users who opted out, are on leave or are in Do Not Disturb
+// mode are left alone.
+func Job(s store.Store, opts Options) func(at time.Time) {
+	return func(at time.Time) {
+		if h, ok := opts.Holidays.Holiday(at); ok {
+			log.Infof("Not nudging anyone on %s", h.Name)
+			return
+		}
+
+		if opts.BotToken == "" {
+			log.Error("Cannot nudge: No token provided")
+			return
+		}
+
+		client := slack.New(opts.BotToken)
+		users, err := client.GetUsers()
+		if err != nil {
+			log.Errorf("Cannot nudge: Cannot get users: %s", err)
+			return
+		}
+
+		today := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+
+		var idle []slack.User
+		for _, user := range users {
+			if user.IsBot || user.Deleted || user.ID == "USLACKBOT" {
+				continue
+			}
+
+			prefs, err := s.GetUser(user.ID)
+			if err != nil {
+				log.Errorf("Cannot get preferences of %s: %s", user.Name, err)
+				continue
+			}
+
+			if prefs.NoNudge || prefs.OnLeave(today, today.AddDate(0, 0, 1)) {
+				continue
+			}
+
+			list, err := s.ListByUser(user.Name, today, time.Time{})
+			if err != nil {
+				log.Errorf("Cannot query items of %s: %s", user.Name, err)
+				continue
+			}
+
+			if len(list) == 0 {
+				idle = append(idle, user)
+			}
+		}
+
+		dnd := inDND(client, idle, at)
+
+		for _, user := range idle {
+			if dnd[user.ID] {
+				log.Infof("Not nudging %s, who is in Do Not Disturb mode", user.Name)
+				continue
+			}
+
+			if err := send(client, opts, user, at); err != nil {
+				log.Errorf("Cannot nudge %s: %s", user.Name, err)
+			}
+		}
+	}
+}
+
+// Send the nudge message to the user in a direct message
+func send(client *slack.Client, opts Options, user slack.User, at time.Time) error {
+	text, err := opts.Templates.Render("nudge", render.Data{
+		User: fmt.Sprintf("<@%s|%s>", user.ID, user.Name),
+		Date: at.Format(calendar.Day),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, _, channel, err := client.OpenIMChannel(user.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = bot.Post(opts.BotToken, channel, text, nil)
+	return err
+}
+
+// Users who are in Do Not Disturb mode or snoozed at the time.
+// When the status is unknown, users are nudged anyway.
+func inDND(client *slack.Client, users []slack.User, at time.Time) map[string]bool {
+	if len(users) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+
+	statuses, err := client.GetDNDTeamInfo(ids)
+	if err != nil {
+		log.Errorf("Cannot get Do Not Disturb status: %s", err)
+		return nil
+	}
+
+	now := int(at.Unix())
+	dnd := map[string]bool{}
+	for id, status := range statuses {
+		scheduled := status.Enabled && status.NextStartTimestamp <= now && now < status.NextEndTimestamp
+		snoozed := status.SnoozeEnabled && now < status.SnoozeEndTime
+		dnd[id] = scheduled || snoozed
+	}
+
+	return dnd
+}
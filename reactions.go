@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Reaction to a message, from RTM or from the Events API
+type reaction struct {
+	// User who reacted and author of the message
+	User     string
+	ItemUser string
+
+	Emoji     string
+	Channel   string
+	Timestamp string
+}
+
+// Make an item of the message when its author reacts to it with one of the
+// emojis of the configuration. A message makes one item at most.
+func reactionAdded(items store.ItemStore, config Configuration, token string, r reaction) {
+	kind := reactionKind(config, r.Emoji)
+	if kind == "" || r.User != r.ItemUser || r.Channel == "" {
+		return
+	}
+
+	if _, err := items.GetBySource(r.Channel, r.Timestamp); err != store.ErrNotFound {
+		if err != nil {
+			log.Errorf("Cannot find item of message %s in %s: %s", r.Timestamp, r.Channel, err)
+		}
+		return
+	}
+
+	message, err := bot.Message(token, r.Channel, r.Timestamp)
+	if err != nil {
+		log.Errorf("Cannot get message %s in %s: %s", r.Timestamp, r.Channel, err)
+		return
+	}
+
+	user, err := slack.New(token).GetUserInfo(r.User)
+	if err != nil {
+		log.Errorf("Cannot get user %s: %s", r.User, err)
+		return
+	}
+
+	if strings.TrimSpace(message.Text) == "" {
+		return
+	}
+
+	item := newItem(message.Text, user.ID, user.Name, kind)
+	item.Source = &store.Source{Channel: r.Channel, Timestamp: r.Timestamp}
+	if identity, err := bot.IdentityOf(token); err == nil {
+		item.Source.Permalink = bot.Permalink(identity.URL, r.Channel, r.Timestamp)
+	}
+
+	if err := saveItem(items, &item, nil, config); err != nil {
+		log.Errorf("Cannot add item of %s: %s", user.Name, err)
+		return
+	}
+
+	log.Infof("Added %s item %s from :%s: of %s", kind, item.ID.Hex(), r.Emoji, user.Name)
+}
+
+// Delete the item made from the message when its author takes the reaction
+// back, with its posts
+func reactionRemoved(items store.ItemStore, config Configuration, r reaction) {
+	if reactionKind(config, r.Emoji) == "" || r.User != r.ItemUser {
+		return
+	}
+
+	item, err := items.GetBySource(r.Channel, r.Timestamp)
+	if err == store.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Errorf("Cannot find item of message %s in %s: %s", r.Timestamp, r.Channel, err)
+		return
+	}
+
+	// Another configured emoji may have made the item
+	if item.Kind != reactionKind(config, r.Emoji) {
+		return
+	}
+
+	if _, err := deleteItem(items, config, r.User, item.ID.Hex()); err != nil {
+		log.Errorf("Cannot delete item %s: %s", item.ID.Hex(), err)
+	}
+}
+
+// Kind of item the emoji makes, none when it is not configured.
+// Skin tones do not matter, "+1::skin-tone-2" is "+1".
+func reactionKind(config Configuration, emoji string) string {
+	emoji = strings.SplitN(emoji, "::", 2)[0]
+
+	return config.Reactions[emoji]
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func TestReactionAdded(t *testing.T) {
+	slack := newFakeSlack(t)
+	defer slack.Close()
+
+	slack.respond("conversations.history", `{"ok": true, "messages": [{"type": "message", "user": "U1", "text": "Deploy the API", "ts": "1476601200.000100"}]}`)
+	slack.respond("users.info", `{"ok": true, "user": {"id": "U1", "name": "bob"}}`)
+
+	items := store.NewMemoryStore()
+	config := testConfig()
+	config.Reactions = map[string]string{"eyes": store.KindWorking}
+
+	tests := []struct {
+		name  string
+		r     reaction
+		added bool
+	}{
+		{"emoji not configured", reaction{"U1", "U1", "tada", "C1", "1476601200.000100"}, false},
+		{"reaction of another user", reaction{"U2", "U1", "eyes", "C1", "1476601200.000100"}, false},
+		{"reaction of the author", reaction{"U1", "U1", "eyes::skin-tone-2", "C1", "1476601200.000100"}, true},
+		{"second reaction of the author", reaction{"U1", "U1", "eyes", "C1", "1476601200.000100"}, false},
+	}
+
+	for _, test := range tests {
+		before, _ := items.ListByUser("bob", time.Time{}, time.Time{})
+		reactionAdded(items, config, "xoxb-test", test.r)
+		after, _ := items.ListByUser("bob", time.Time{}, time.Time{})
+
+		if added := len(after) > len(before); added != test.added {
+			t.Errorf("%s: added %v, want %v", test.name, added, test.added)
+		}
+	}
+
+	item, err := items.GetBySource("C1", "1476601200.000100")
+	if err != nil {
+		t.Fatalf("GetBySource: %s", err)
+	}
+	if item.Text != "Deploy the API" || item.Kind != store.KindWorking || item.UserID != "U1" {
+		t.Errorf("item: got %q %s of %s", item.Text, item.Kind, item.UserID)
+	}
+
+	reactionRemoved(items, config, reaction{"U2", "U1", "eyes", "C1", "1476601200.000100"})
+	if _, err := items.GetBySource("C1", "1476601200.000100"); err != nil {
+		t.Errorf("removal of another user: %v", err)
+	}
+
+	reactionRemoved(items, config, reaction{"U1", "U1", "eyes", "C1", "1476601200.000100"})
+	if _, err := items.GetBySource("C1", "1476601200.000100"); err != store.ErrNotFound {
+		t.Errorf("removal of the author: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,213 @@
+package remind
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/calendar"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/schedule"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Runner keeps one running job per reminder, by key.
+// Reminders are not posted on holidays.
+type Runner struct {
+	mu       sync.Mutex
+	running  map[string]running
+	holidays *calendar.Calendar
+}
+
+type running struct {
+	reminder store.Reminder
+	job      *schedule.Job
+}
+
+// Entry is a running reminder and its key
+type Entry struct {
+	Key      string
+	Reminder store.Reminder
+}
+
+func NewRunner(holidays *calendar.Calendar) *Runner {
+	return &Runner{running: map[string]running{}, holidays: holidays}
+}
+
+// SetHolidays replaces the holidays reminders are not posted on
+func (r *Runner) SetHolidays(holidays *calendar.Calendar) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.holidays = holidays
+}
+
+func (r *Runner) isHoliday(at time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.holidays.IsHoliday(at)
+}
+
+// Start posts the reminder with the token on its schedule, in place of the
+// reminder which had the same key if any
+func (r *Runner) Start(key string, reminder store.Reminder, token string) error {
+	when, skip, err := parse(reminder)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if old, ok := r.running[key]; ok {
+		old.job.Stop()
+	}
+
+	job := schedule.Run(when, func(at time.Time) {
+		if skip(at) || r.isHoliday(at) {
+			log.Infof("Skipping reminder %s on %s", key, at.Format(calendar.Day))
+			return
+		}
+
+		if err := post(reminder, token, at); err != nil {
+			log.Errorf("Cannot post reminder %s to %s: %s", key, reminder.Channel, err)
+		}
+	})
+
+	r.running[key] = running{reminder: reminder, job: job}
+	return nil
+}
+
+// Stop cancels the reminder of the key, it tells if there was one
+func (r *Runner) Stop(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.running[key]
+	if ok {
+		old.job.Stop()
+		delete(r.running, key)
+	}
+
+	return ok
+}
+
+// List the running reminders by key
+func (r *Runner) List() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []Entry
+	for key, running := range r.running {
+		entries = append(entries, Entry{Key: key, Reminder: running.reminder})
+	}
+
+	sort.Sort(byKey(entries))
+	return entries
+}
+
+type byKey []Entry
+
+func (a byKey) Len() int           { return len(a) }
+func (a byKey) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byKey) Less(i, j int) bool { return a[i].Key < a[j].Key }
+
+// Validate checks the channel, schedule, timezone, skip rules and text of a
+// reminder, so it does not fail later when it is due. A schedule which
+// never comes is invalid too.
+func Validate(reminder store.Reminder) error {
+	if reminder.Channel == "" {
+		return errors.New("Missing channel")
+	}
+
+	if strings.TrimSpace(reminder.Text) == "" {
+		return errors.New("Missing text")
+	}
+
+	when, _, err := parse(reminder)
+	if err != nil {
+		return err
+	}
+
+	// e.g. "0 0 31 2 *", February has no 31st
+	if when.Next(time.Now()).IsZero() {
+		return errors.New("The schedule never comes")
+	}
+
+	return render.Check(reminder.Text)
+}
+
+func parse(reminder store.Reminder) (schedule.Cron, func(at time.Time) bool, error) {
+	when, err := schedule.NewCron(reminder.Schedule, reminder.Timezone)
+	if err != nil {
+		return when, nil, err
+	}
+
+	skip, err := ParseSkip(reminder.Skip)
+	if err != nil {
+		return when, nil, err
+	}
+
+	return when, skip, nil
+}
+
+func post(reminder store.Reminder, token string, at time.Time) error {
+	text, err := render.Execute(reminder.Text, render.Data{
+		Date: at.Format(calendar.Day),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = bot.Post(token, reminder.Channel, text, nil)
+	return err
+}
+
+// ParseSkip parses skip rules into a function which tells if a reminder is
+// skipped at a time, by its local date.
+// Rules are weekday names, "2006-01-02" dates and "2006-01-02..2006-01-05"
+// ranges, both ends included.
+func ParseSkip(rules []string) (func(at time.Time) bool, error) {
+	var weekdays []time.Weekday
+	var ranges [][2]string
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+
+		if day, err := schedule.ParseWeekday(rule); err == nil {
+			weekdays = append(weekdays, day)
+			continue
+		}
+
+		from, to, err := calendar.ParseRange(rule)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid skip rule %q, expected a weekday, a date or a date range", rule)
+		}
+
+		ranges = append(ranges, [2]string{from, to})
+	}
+
+	return func(at time.Time) bool {
+		for _, day := range weekdays {
+			if at.Weekday() == day {
+				return true
+			}
+		}
+
+		date := at.Format(calendar.Day)
+		for _, r := range ranges {
+			if r[0] <= date && date <= r[1] {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
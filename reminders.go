@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dwarvesf/working-on/remind"
+	"github.com/dwarvesf/working-on/schedule"
+	"github.com/dwarvesf/working-on/secret"
+	"github.com/dwarvesf/working-on/store"
+)
+
+const remindUsage = "Usage: `/working remind add <#channel> <minute> <hour> <day> <month> <weekday> [tz:<timezone>] [skip:<rule,...>] <text>`, `/working remind list` or `/working remind remove <id>`"
+
+// Key of the reminder which replaces the former DAILYSCRUM_TIME reminder
+const dailyScrumKey = "daily-scrum"
+
+// Channel reference as Slack escapes it in commands, e.g. <#C024BE91L|general>
+var channelRef = regexp.MustCompile(`^<#([A-Z0-9]+)(\|[^>]*)?>$`)
+
+// Start the legacy daily scrum reminder, then the ones added at runtime
+func startReminders(runner *remind.Runner, reminders store.ReminderStore) {
+	if reminder, ok := dailyScrumReminder(); ok {
+		if err := runner.Start(dailyScrumKey, reminder, reminderToken(reminder)); err != nil {
+			log.Fatalf("Invalid daily scrum reminder: %s", err)
+		}
+	}
+
+	stored, err := reminders.ListReminders()
+	if err != nil {
+		log.Errorf("Cannot load reminders: %s", err)
+		return
+	}
+
+	for _, reminder := range stored {
+		if err := runner.Start(reminder.ID.Hex(), reminder, reminderToken(reminder)); err != nil {
+			log.Errorf("Cannot start reminder %s: %s", reminder.ID.Hex(), err)
+		}
+	}
+}
+
+// Reminder of DAILYSCRUM_TIME and DAILYSCRUM_URL, which were used before
+// reminders could be configured, posted on weekdays in UTC
+func dailyScrumReminder() (store.Reminder, bool) {
+	at := os.Getenv("DAILYSCRUM_TIME")
+	url := os.Getenv("DAILYSCRUM_URL")
+	if at == "" || url == "" {
+		return store.Reminder{}, false
+	}
+
+	hour, minute, err := schedule.ParseClock(at)
+	if err != nil {
+		log.Fatalf("Invalid DAILYSCRUM_TIME: %s", err)
+	}
+
+	return store.Reminder{
+		Channel:  "#random",
+		Text:     "Đến giờ daily scrum rồi mấy bé <!here|here> " + url + " :4head:",
+		Schedule: fmt.Sprintf("%d %d * * mon-fri", minute, hour),
+	}, true
+}
+
+func reminderToken(reminder store.Reminder) string {
+	if reminder.Token == "" {
+		return os.Getenv("BOT_TOKEN")
+	}
+
+	token, err := secret.Resolve(reminder.Token)
+	if err != nil {
+		log.Errorf("Cannot resolve token of reminder to %s: %s", reminder.Channel, err)
+	}
+
+	return token
+}
+
+// Handle `/working remind <add|list|remove>`
+func remindCommand(reminders store.ReminderStore, runner *remind.Runner, userID, text string) (string, error) {
+	command, args := splitCommand(text)
+
+	switch command {
+	case "add":
+		return addReminder(reminders, runner, userID, args)
+	case "list":
+		return listReminders(runner), nil
+	case "remove":
+		return removeReminder(reminders, runner, userID, args)
+	}
+
+	return "", commandError(remindUsage)
+}
+
+func addReminder(reminders store.ReminderStore, runner *remind.Runner, userID, text string) (string, error) {
+	reminder, err := parseReminder(text)
+	if err != nil {
+		return "", commandError(fmt.Sprintf("%s.\n%s", err, remindUsage))
+	}
+
+	if err := remind.Validate(reminder); err != nil {
+		return "", commandError(fmt.Sprintf("%s.\n%s", err, remindUsage))
+	}
+
+	reminder.UserID = userID
+	reminder.CreatedAt = time.Now()
+	if err := reminders.InsertReminder(&reminder); err != nil {
+		return "", err
+	}
+
+	if err := runner.Start(reminder.ID.Hex(), reminder, reminderToken(reminder)); err != nil {
+		return "", err
+	}
+
+	when, _ := schedule.NewCron(reminder.Schedule, reminder.Timezone)
+	next := when.Next(time.Now())
+
+	return fmt.Sprintf("Added reminder `%s` to %s, next one on %s", reminder.ID.Hex(), channelName(reminder.Channel), next.Format("Mon Jan 2 15:04 MST")), nil
+}
+
+// Parse `<#channel> <5 schedule fields> [tz:<timezone>] [skip:<rule,...>] <text>`
+func parseReminder(text string) (store.Reminder, error) {
+	var reminder store.Reminder
+
+	channel, rest := popWord(text)
+	if m := channelRef.FindStringSubmatch(channel); m != nil {
+		reminder.Channel = m[1]
+	} else if strings.HasPrefix(channel, "#") {
+		reminder.Channel = channel
+	} else {
+		return reminder, errors.New("Missing channel")
+	}
+
+	var fields []string
+	for i := 0; i < 5; i++ {
+		var field string
+		field, rest = popWord(rest)
+		fields = append(fields, field)
+	}
+	reminder.Schedule = strings.Join(fields, " ")
+
+	for {
+		word, next := popWord(rest)
+		switch {
+		case strings.HasPrefix(word, "tz:"):
+			reminder.Timezone = strings.TrimPrefix(word, "tz:")
+		case strings.HasPrefix(word, "skip:"):
+			reminder.Skip = strings.Split(strings.TrimPrefix(word, "skip:"), ",")
+		default:
+			reminder.Text = rest
+			return reminder, nil
+		}
+		rest = next
+	}
+}
+
+func listReminders(runner *remind.Runner) string {
+	entries := runner.List()
+	if len(entries) == 0 {
+		return "There is no reminder yet.\n" + remindUsage
+	}
+
+	var lines []string
+	for _, entry := range entries {
+		r := entry.Reminder
+
+		line := fmt.Sprintf("`%s` `%s`", entry.Key, r.Schedule)
+		if r.Timezone != "" {
+			line += " " + r.Timezone
+		}
+		line += fmt.Sprintf(" to %s: %s", channelName(r.Channel), r.Text)
+		if len(r.Skip) > 0 {
+			line += fmt.Sprintf(" _(skips %s)_", strings.Join(r.Skip, ", "))
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Remove a reminder added with `/working remind add`, only the user who
+// added it can
+func removeReminder(reminders store.ReminderStore, runner *remind.Runner, userID, id string) (string, error) {
+	if !bson.IsObjectIdHex(id) {
+		return "", commandError("Usage: `/working remind remove <id>`, configured reminders can only be removed from the configuration")
+	}
+
+	stored, err := reminders.ListReminders()
+	if err != nil {
+		return "", err
+	}
+
+	var reminder *store.Reminder
+	for i := range stored {
+		if stored[i].ID.Hex() == id {
+			reminder = &stored[i]
+		}
+	}
+
+	if reminder == nil {
+		return "", commandError(fmt.Sprintf("There is no reminder `%s`.", id))
+	}
+	if reminder.UserID != userID {
+		return "", commandError("You can only remove the reminders you added.")
+	}
+
+	err = reminders.DeleteReminder(reminder.ID)
+	if err == store.ErrNotFound {
+		return "", commandError(fmt.Sprintf("There is no reminder `%s`.", id))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	runner.Stop(id)
+	return fmt.Sprintf("Removed reminder `%s`", id), nil
+}
+
+// Channels are kept by name or by id, Slack shows ids as links
+func channelName(channel string) string {
+	if strings.HasPrefix(channel, "#") {
+		return channel
+	}
+
+	return "<#" + channel + ">"
+}
+
+// Split the first word from the rest of the text, keeping its case
+func popWord(text string) (string, string) {
+	text = strings.TrimSpace(text)
+
+	if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i+1:])
+	}
+
+	return text, ""
+}
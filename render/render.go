@@ -0,0 +1,265 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Data holds every variable a template can use, unused ones are left empty
+type Data struct {
+	// User is the Slack formatted author of an item
+	User string
+	// Date of an item, or of the digest period
+	Date   string
+	Period string
+	Text   string
+	Kind   string
+	// Link is the permalink of the message an item was made from, or in
+	// digests of the repost of an item
+	Link string
+	// Status of a task, open or done, and the time it took when done.
+	// Blocked items are open or resolved.
+	Status   string
+	Duration string
+	// Estimate of a working item and what blocks it
+	Estimate string
+	Blockers string
+	// Leads of the tags of a blocked item, user ids as Mentions, and the
+	// Slack formatted user who resolved it
+	Leads      []string
+	ResolvedBy string
+	// Age of an open blocker in digests, e.g. "3 days"
+	Age  string
+	Tags []string
+	// Entities of an item: ids of mentioned users and channels, shown with
+	// <@{{.}}> and <#{{.}}>, URLs and issue keys
+	Mentions []string
+	Channels []string
+	URLs     []string
+	Issues   []string
+	// Items are the lines of a person in the daily digest, the rendered
+	// item lines under the title of their section
+	Items []string
+	// Count of people in a digest, or of items of a person. Counts of items
+	// per kind, per tag in roll-up titles.
+	Count  int
+	Counts map[string]int
+}
+
+// Defaults are the templates used when none is configured
+var Defaults = map[string]string{
+	// Digest
+	"title":        " :rocket: >> Team daily digest for *{{.Date}}* :rocket: <!channel>",
+	"rollup_title": " :trophy: >> Team {{.Period}} roll-up for *{{.Date}}* :trophy: <!channel>",
+	"item":         "+ {{.Text}}{{if .Duration}} _(took {{.Duration}})_{{end}}{{if .Link}} <{{.Link}}|:link:>{{end}}",
+	"color":        "#7CD197",
+	"footer":       "Oshin Bot",
+	"on_leave":     "_On leave_ :palm_tree:",
+	"user":         "{{range $i, $line := .Items}}{{if $i}}\n{{end}}{{$line}}{{end}}",
+	"blocker":      "+ *{{.User}}* {{.Text}} _({{.Age}})_{{if .Link}} <{{.Link}}|:link:>{{end}}",
+
+	// Repost of an item, by kind
+	"working": "*{{.User}}* is *working* on: {{.Text}}{{if .Estimate}} _(estimate {{.Estimate}})_{{end}}{{if .Link}} <{{.Link}}|:link:>{{end}}{{if .Blockers}}\n:construction: Blocked by: {{.Blockers}}{{end}}",
+	"done":    ":cantboiroi: *{{.User}}* has *done*: {{.Text}}{{if .Duration}} _(took {{.Duration}})_{{end}}{{if .Link}} <{{.Link}}|:link:>{{end}}",
+	"til":     "*{{.User}}* #til - Today I learned: {{.Text}} :adore:{{if .Link}} <{{.Link}}|:link:>{{end}}",
+	"blocked": ":construction: *{{.User}}* is *blocked*: {{.Text}}{{if .Link}} <{{.Link}}|:link:>{{end}}{{if .ResolvedBy}}\n:white_check_mark: Resolved by {{.ResolvedBy}}{{else}}{{range .Leads}} <@{{.}}>{{end}}{{end}}",
+
+	// Direct message to people without items of the day
+	"nudge": "Hey {{.User}}, you have not posted anything today. What are you working on? Let your team know with `/working <what you are doing>`. (`/working nudge off` stops these messages.)",
+}
+
+// Sample data to validate templates when they are loaded
+var sample = Data{
+	User:     "<@U024BE7LH|bob>",
+	Date:     "2017-01-01",
+	Period:   "daily",
+	Text:     "sample #tag",
+	Link:     "https://example.slack.com/archives/C024BE91L/p1483228800000002",
+	Status:   "done",
+	Duration: "2h 30m",
+	Estimate: "1d",
+	Blockers: "review of #42",
+	Kind:     "done",
+
+	Leads:      []string{"U024BE7LH"},
+	ResolvedBy: "<@U024BE7LH|bob>",
+	Age:        "3 days",
+
+	Tags:     []string{"#tag"},
+	Mentions: []string{"U024BE7LH"},
+	Channels: []string{"C024BE91L"},
+	URLs:     []string{"https://example.com"},
+	Issues:   []string{"ABC-123"},
+	Items:    []string{"+ sample #tag"},
+	Count:    1,
+	Counts:   map[string]int{"done": 1},
+}
+
+// Set of templates by name, names which are not in the set fall back to
+// the parent set then to Defaults
+type Set struct {
+	parent    *Set
+	templates map[string]*template.Template
+}
+
+var defaultSet = mustCompile(Defaults)
+
+// Default returns the set of default templates
+func Default() *Set {
+	return defaultSet
+}
+
+// Load reads template files by name, on top of parent.
+// A nil parent means Defaults.
+func Load(parent *Set, files map[string]string) (*Set, error) {
+	sources := map[string]string{}
+
+	for name, path := range files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read template %s from %s", name, path)
+		}
+
+		// Files usually end with a newline which is not part of the message
+		sources[name] = strings.TrimRight(string(content), "\n")
+	}
+
+	set, err := compile(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	set.parent = parent
+	return set, nil
+}
+
+// Render executes the template of the name with data
+func (s *Set) Render(name string, data Data) (string, error) {
+	t := s.lookup(name)
+	if t == nil {
+		return "", fmt.Errorf("Unknown template %s", name)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// Execute parses and executes a template which is not part of a set,
+// e.g. the message of a reminder
+func Execute(source string, data Data) (string, error) {
+	t, err := template.New("message").Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("Invalid template: %s", err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("Invalid template: %s", err)
+	}
+
+	return b.String(), nil
+}
+
+// Check tries a template which is not part of a set with sample data
+func Check(source string) error {
+	_, err := Execute(source, sample)
+	return err
+}
+
+func (s *Set) lookup(name string) *template.Template {
+	for set := s; set != nil; set = set.parent {
+		if t, ok := set.templates[name]; ok {
+			return t
+		}
+	}
+
+	if s != defaultSet {
+		return defaultSet.templates[name]
+	}
+
+	return nil
+}
+
+// Parse templates and try them with sample data, so unknown names and
+// variables are found on load instead of when posting
+func compile(sources map[string]string) (*Set, error) {
+	set := &Set{templates: map[string]*template.Template{}}
+
+	for name, source := range sources {
+		if _, ok := Defaults[name]; !ok {
+			return nil, fmt.Errorf("Unknown template %s", name)
+		}
+
+		t, err := template.New(name).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template %s: %s", name, err)
+		}
+
+		if err := t.Execute(ioutil.Discard, sample); err != nil {
+			return nil, fmt.Errorf("Invalid template %s: %s", name, err)
+		}
+
+		set.templates[name] = t
+	}
+
+	return set, nil
+}
+
+// Duration formats a duration for people, e.g. "2d 3h" or "45m"
+func Duration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	if d < time.Minute {
+		return "less than a minute"
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%dd", days)
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// Age formats the whole days from t to now for people, e.g. "today" or "3 days"
+func Age(t, now time.Time) string {
+	days := int(now.Sub(t) / (24 * time.Hour))
+
+	switch {
+	case days < 1:
+		return "today"
+	case days == 1:
+		return "1 day"
+	}
+
+	return fmt.Sprintf("%d days", days)
+}
+
+func mustCompile(sources map[string]string) *Set {
+	set, err := compile(sources)
+	if err != nil {
+		panic(err)
+	}
+
+	return set
+}
@@ -0,0 +1,373 @@
+package route
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Rule tells if an item goes to a destination
+type Rule interface {
+	Match(item store.Item) bool
+	String() string
+}
+
+// Parse parses a rule expression. Terms are
+//
+//	#tag         the item has the hashtag, in any case
+//	/regexp/     the text matches the regexp, /regexp/i in any case
+//	from:name    the author has the name or the user id
+//	kind:done    the item has the kind
+//	word         the text has the word, in any case
+//
+// and they combine with AND, OR, NOT and parentheses. Terms next to each
+// other must all match, as with AND.
+//
+//	(#classify OR #clipchute) AND NOT from:bot
+func Parse(expr string) (Rule, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Empty rule")
+	}
+
+	p := &parser{tokens: tokens}
+	rule, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected %q in rule", p.tokens[p.pos])
+	}
+
+	return rule, nil
+}
+
+// Tags returns the rule of items with any of the hashtags, nil without tags.
+// Tags without # get one.
+func Tags(tags []string) Rule {
+	var rules []Rule
+	for _, tag := range tags {
+		rules = append(rules, hashtag(store.NormalizeTag(tag)))
+	}
+
+	switch len(rules) {
+	case 0:
+		return nil
+	case 1:
+		return rules[0]
+	}
+
+	return or(rules)
+}
+
+// And returns the rule of items matching every rule, nil rules are left out
+func And(rules ...Rule) Rule {
+	var list []Rule
+	for _, rule := range rules {
+		if rule != nil {
+			list = append(list, rule)
+		}
+	}
+
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+
+	return and(list)
+}
+
+type hashtag string
+
+func (h hashtag) Match(item store.Item) bool {
+	for _, tag := range item.Entities.Tags {
+		if tag == string(h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h hashtag) String() string { return string(h) }
+
+type pattern struct {
+	re     *regexp.Regexp
+	source string
+}
+
+func (p pattern) Match(item store.Item) bool { return p.re.MatchString(item.Text) }
+func (p pattern) String() string             { return p.source }
+
+type from string
+
+func (f from) Match(item store.Item) bool {
+	return strings.EqualFold(item.Name, string(f)) || item.UserID == string(f)
+}
+
+func (f from) String() string { return "from:" + string(f) }
+
+type kind string
+
+func (k kind) Match(item store.Item) bool {
+	if item.Kind == "" {
+		return store.GuessKind(item.Text) == string(k)
+	}
+
+	return item.Kind == string(k)
+}
+
+func (k kind) String() string { return "kind:" + string(k) }
+
+type word string
+
+func (w word) Match(item store.Item) bool {
+	for _, field := range strings.FieldsFunc(strings.ToLower(item.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if field == string(w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w word) String() string { return string(w) }
+
+type not struct{ rule Rule }
+
+func (n not) Match(item store.Item) bool { return !n.rule.Match(item) }
+func (n not) String() string             { return "NOT " + n.rule.String() }
+
+type and []Rule
+
+func (a and) Match(item store.Item) bool {
+	for _, rule := range a {
+		if !rule.Match(item) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a and) String() string { return join(a, " AND ") }
+
+type or []Rule
+
+func (o or) Match(item store.Item) bool {
+	for _, rule := range o {
+		if rule.Match(item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o or) String() string { return join(o, " OR ") }
+
+func join(rules []Rule, sep string) string {
+	parts := make([]string, len(rules))
+	for i, rule := range rules {
+		parts[i] = rule.String()
+	}
+
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// Recursive descent parser of rule expressions, NOT binds tighter than AND,
+// which binds tighter than OR
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *parser) or() (Rule, error) {
+	rules := []Rule{}
+	for {
+		rule, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+
+		if p.peek() != "OR" {
+			break
+		}
+		p.pos++
+	}
+
+	if len(rules) == 1 {
+		return rules[0], nil
+	}
+
+	return or(rules), nil
+}
+
+func (p *parser) and() (Rule, error) {
+	rules := []Rule{}
+	for {
+		rule, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+
+		switch p.peek() {
+		case "AND":
+			p.pos++
+			continue
+		case "", "OR", ")":
+		default:
+			// Terms next to each other
+			continue
+		}
+		break
+	}
+
+	if len(rules) == 1 {
+		return rules[0], nil
+	}
+
+	return and(rules), nil
+}
+
+func (p *parser) not() (Rule, error) {
+	token := p.peek()
+
+	switch token {
+	case "":
+		return nil, fmt.Errorf("Unexpected end of rule")
+	case "NOT":
+		p.pos++
+		rule, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return not{rule}, nil
+	case "(":
+		p.pos++
+		rule, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("Missing ) in rule")
+		}
+		p.pos++
+		return rule, nil
+	case ")", "AND", "OR":
+		return nil, fmt.Errorf("Unexpected %q in rule", token)
+	}
+
+	p.pos++
+	return term(token)
+}
+
+func term(token string) (Rule, error) {
+	switch {
+	case strings.HasPrefix(token, "#"):
+		if len(token) == 1 {
+			return nil, fmt.Errorf("Empty hashtag in rule")
+		}
+		return hashtag(store.NormalizeTag(token)), nil
+	case strings.HasPrefix(token, "/"):
+		end := strings.LastIndex(token, "/")
+		source, flags := token[1:end], token[end+1:]
+		if flags != "" && flags != "i" {
+			return nil, fmt.Errorf("Unknown regexp flags %q in rule, only i is supported", flags)
+		}
+		if flags == "i" {
+			source = "(?i)" + source
+		}
+
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regexp %s in rule: %s", token, err)
+		}
+		return pattern{re, token}, nil
+	case strings.HasPrefix(token, "from:"):
+		// from:bob, from:@bob or from:<@U024BE7LH|bob>
+		name := strings.TrimPrefix(token, "from:")
+		if strings.HasPrefix(name, "<@") && strings.HasSuffix(name, ">") {
+			name = strings.SplitN(name[2:len(name)-1], "|", 2)[0]
+		}
+		name = strings.TrimPrefix(name, "@")
+		if name == "" {
+			return nil, fmt.Errorf("Empty user in rule")
+		}
+		return from(name), nil
+	case strings.HasPrefix(token, "kind:"):
+		k := strings.TrimPrefix(token, "kind:")
+		if k != store.KindWorking && k != store.KindDone && k != store.KindTIL && k != store.KindBlocked {
+			return nil, fmt.Errorf("Unknown kind %q in rule", k)
+		}
+		return kind(k), nil
+	}
+
+	return word(strings.ToLower(token)), nil
+}
+
+// Split an expression into parentheses, regexps and words
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '/':
+			// Up to the next slash which is not escaped, then flags
+			end := i + 1
+			for end < len(expr) && expr[end] != '/' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("Unterminated regexp in rule")
+			}
+			end++
+			for end < len(expr) && unicode.IsLetter(rune(expr[end])) {
+				end++
+			}
+			tokens = append(tokens, expr[i:end])
+			i = end
+		default:
+			end := i
+			for end < len(expr) && strings.IndexByte(" \t\n()", expr[end]) < 0 {
+				end++
+			}
+			tokens = append(tokens, expr[i:end])
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
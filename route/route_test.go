@@ -0,0 +1,122 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func item(name, text string) store.Item {
+	i := store.Item{Name: name, UserID: "U024BE7LH", Kind: store.KindWorking}
+	i.SetText(text)
+	return i
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		// String of the parsed rule, its grouping shows the precedence
+		rule string
+	}{
+		{"#classify", "#classify"},
+		{"deploy #classify", "(deploy AND #classify)"},
+		{"a OR b AND c", "(a OR (b AND c))"},
+		{"a AND b OR c", "((a AND b) OR c)"},
+		{"NOT a AND b", "(NOT a AND b)"},
+		{"NOT a OR b", "(NOT a OR b)"},
+		{"NOT (a OR b)", "NOT (a OR b)"},
+		{"NOT NOT a", "NOT NOT a"},
+		{"a b OR c d", "((a AND b) OR (c AND d))"},
+		{"(#classify OR #clipchute) AND NOT from:bot", "((#classify OR #clipchute) AND NOT from:bot)"},
+		{"/deploy(ed)?/i kind:done", "(/deploy(ed)?/i AND kind:done)"},
+		{"from:<@U024BE7LH|bob>", "from:U024BE7LH"},
+	}
+
+	for _, test := range tests {
+		rule, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", test.expr, err)
+			continue
+		}
+
+		if rule.String() != test.rule {
+			t.Errorf("Parse(%q) = %s, want %s", test.expr, rule, test.rule)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"a AND",
+		"OR a",
+		"(a OR b",
+		"a)",
+		"NOT",
+		"/deploy",
+		"/deploy/g",
+		"/(/",
+		"#",
+		"from:",
+		"kind:todo",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): want an error", expr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expr  string
+		item  store.Item
+		match bool
+	}{
+		{"#classify OR #clipchute AND kind:done", item("bob", "Fix #classify"), true},
+		{"#classify OR #clipchute AND kind:done", item("bob", "Fix #clipchute"), false},
+		{"(#classify OR #clipchute) AND NOT from:bob", item("bob", "Fix #classify"), false},
+		{"(#classify OR #clipchute) AND NOT from:bob", item("alice", "Fix #CLASSIFY"), true},
+		{"NOT #classify OR deploy", item("bob", "deploy #classify"), true},
+		{"NOT (#classify OR deploy)", item("bob", "deploy #classify"), false},
+		{"deploy api", item("bob", "Deploy the API"), true},
+		{"deploy api", item("bob", "Deployed the API"), false},
+		{"/deploy(ed)?/i", item("bob", "Deployed the API"), true},
+		{"/deploy(ed)?/", item("bob", "Deployed the API"), false},
+		{"from:U024BE7LH", item("bob", "anything"), true},
+		{"from:@BOB", item("bob", "anything"), true},
+		{"#class", item("bob", "Fix #classify"), false},
+		{"#class", item("bob", "Fix #class, then #classify"), true},
+	}
+
+	for _, test := range tests {
+		rule, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", test.expr, err)
+			continue
+		}
+
+		if match := rule.Match(test.item); match != test.match {
+			t.Errorf("%q matches %q: got %v, want %v", test.expr, test.item.Text, match, test.match)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	rule := Tags([]string{"#class", "clipchute"})
+
+	tests := []struct {
+		text  string
+		match bool
+	}{
+		{"Fix #class", true},
+		{"Fix #classify", false},
+		{"Fix #CLIPCHUTE", true},
+		{"Fix clipchute", false},
+	}
+
+	for _, test := range tests {
+		if match := rule.Match(item("bob", test.text)); match != test.match {
+			t.Errorf("%s matches %q: got %v, want %v", rule, test.text, match, test.match)
+		}
+	}
+}
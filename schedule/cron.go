@@ -0,0 +1,203 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron runs when the time in a location matches a crontab expression:
+// minute, hour, day of month, month and day of week.
+// Fields accept `*`, numbers, names, ranges `1-5`, lists `1,3` and steps `*/15`.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// Crontab runs on either day field when both are restricted
+	domAny, dowAny bool
+	Location       *time.Location
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// NewCron parses a crontab expression and an IANA timezone, e.g.
+// "30 9 * * mon-fri" and "Asia/Ho_Chi_Minh". Empty timezone means UTC.
+func NewCron(expr, timezone string) (Cron, error) {
+	var c Cron
+	var err error
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("Invalid schedule %q, expected 5 fields: minute hour day month weekday", expr)
+	}
+
+	if c.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return c, err
+	}
+	if c.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return c, err
+	}
+	if c.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return c, err
+	}
+	if c.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return c, err
+	}
+
+	weekdays := map[string]int{}
+	for name, day := range weekdayNames {
+		weekdays[name] = int(day)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7, weekdays); err != nil {
+		return c, err
+	}
+
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	// Any field of every day, e.g. `*/1` or `0-6`, leaves the other one alone
+	c.domAny = c.dom == span(1, 31)
+	c.dowAny = c.dow&span(0, 6) == span(0, 6)
+
+	c.Location, err = LoadLocation(timezone)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+func (c Cron) Next(after time.Time) time.Time {
+	local := after.In(c.Location)
+
+	// Every day of four years and a bit, enough to meet a February 29th
+	for i := 0; i <= 5*366; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 0, 0, 0, 0, c.Location)
+		if !c.onDay(day) {
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+			if c.hour&(1<<uint(hour)) == 0 {
+				continue
+			}
+
+			for minute := 0; minute < 60; minute++ {
+				if c.minute&(1<<uint(minute)) == 0 {
+					continue
+				}
+
+				next := wallClock(day, hour, minute, c.Location)
+				if next.After(after) {
+					return next
+				}
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// Time of day in the location. Times skipped when clocks move forward come
+// as the clocks jump over them, 2:30 is 3:30 on the day New York springs
+// forward, as crontab runs them.
+func wallClock(day time.Time, hour, minute int, location *time.Location) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, location)
+	if t.Hour() == hour && t.Minute() == minute {
+		return t
+	}
+
+	_, before := t.Zone()
+	_, after := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, location).Zone()
+
+	return t.Add(time.Duration(after-before) * time.Second)
+}
+
+func (c Cron) onDay(day time.Time) bool {
+	if c.month&(1<<uint(day.Month())) == 0 {
+		return false
+	}
+
+	dom := c.dom&(1<<uint(day.Day())) != 0
+	dow := c.dow&(1<<uint(day.Weekday())) != 0
+
+	switch {
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+
+	return dom || dow
+}
+
+// Parse a field as a set of bits, one per allowed value
+func parseField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("Invalid step in %q", field)
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			from, err = parseValue(bounds[0], min, max, names)
+			if err != nil {
+				return 0, err
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				to, err = parseValue(bounds[1], min, max, names)
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// `5/15` means from 5 to the end, every 15
+				to = max
+			}
+
+			if to < from {
+				return 0, fmt.Errorf("Invalid range in %q", field)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// Bits of the values from min to max
+func span(min, max int) uint64 {
+	return (1<<uint(max+1) - 1) &^ (1<<uint(min) - 1)
+}
+
+func parseValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("Invalid value %q, expected %d to %d", s, min, max)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr     string
+		timezone string
+		after    string
+		next     string
+	}{
+		{"30 9 * * mon-fri", "Asia/Ho_Chi_Minh", "2026-10-16T09:30:00+07:00", "2026-10-19T09:30:00+07:00"},
+		{"30 9 * * mon-fri", "Asia/Ho_Chi_Minh", "2026-10-16T09:29:00+07:00", "2026-10-16T09:30:00+07:00"},
+		{"*/15 * * * *", "", "2026-10-16T23:50:00Z", "2026-10-17T00:00:00Z"},
+		{"5/20 8 * * *", "", "2026-10-16T08:06:00Z", "2026-10-16T08:25:00Z"},
+
+		// Only the day of month, or only the day of week
+		{"0 9 13 * *", "", "2026-10-16T00:00:00Z", "2026-11-13T09:00:00Z"},
+		{"0 9 * * fri", "", "2026-10-17T00:00:00Z", "2026-10-23T09:00:00Z"},
+		// Both restricted: either of them, as crontab does
+		{"0 9 13 * fri", "", "2026-10-17T00:00:00Z", "2026-10-23T09:00:00Z"},
+		{"0 9 13 * fri", "", "2026-11-07T00:00:00Z", "2026-11-13T09:00:00Z"},
+		{"0 9 1 * mon", "", "2026-10-27T00:00:00Z", "2026-11-01T09:00:00Z"},
+		// Fields of every day are not restrictions
+		{"0 9 13 * */1", "", "2026-10-16T00:00:00Z", "2026-11-13T09:00:00Z"},
+		{"0 9 13 * 1-7", "", "2026-10-16T00:00:00Z", "2026-11-13T09:00:00Z"},
+		{"0 9 1-31 * fri", "", "2026-10-17T00:00:00Z", "2026-10-23T09:00:00Z"},
+		// 7 is Sunday too
+		{"0 9 * * 7", "", "2026-10-16T00:00:00Z", "2026-10-18T09:00:00Z"},
+		{"0 0 29 feb *", "", "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 12 31 * *", "", "2026-09-01T00:00:00Z", "2026-10-31T12:00:00Z"},
+
+		// New York springs forward at 2:00 on March 8th 2026, 2:30 is 3:30
+		{"30 2 * * *", "America/New_York", "2026-03-07T02:30:00-05:00", "2026-03-08T03:30:00-04:00"},
+		{"30 2 * * *", "America/New_York", "2026-03-08T03:30:00-04:00", "2026-03-09T02:30:00-04:00"},
+		{"0 9 * * *", "America/New_York", "2026-03-07T09:00:00-05:00", "2026-03-08T09:00:00-04:00"},
+		// and falls back at 2:00 on November 1st, 1:30 comes once
+		{"30 1 * * *", "America/New_York", "2026-10-31T01:30:00-04:00", "2026-11-01T01:30:00-04:00"},
+		{"30 1 * * *", "America/New_York", "2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		{"0 9 * * *", "America/New_York", "2026-10-31T09:00:00-04:00", "2026-11-01T09:00:00-05:00"},
+	}
+
+	for _, test := range tests {
+		cron, err := NewCron(test.expr, test.timezone)
+		if err != nil {
+			t.Errorf("NewCron(%q, %q): %s", test.expr, test.timezone, err)
+			continue
+		}
+
+		after, _ := time.Parse(time.RFC3339, test.after)
+		want, _ := time.Parse(time.RFC3339, test.next)
+
+		if next := cron.Next(after); !next.Equal(want) {
+			t.Errorf("%q in %q after %s: got %s, want %s", test.expr, test.timezone, test.after, next.Format(time.RFC3339), test.next)
+		}
+	}
+}
+
+func TestCronNever(t *testing.T) {
+	cron, err := NewCron("0 0 31 feb *", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := cron.Next(time.Now()); !next.IsZero() {
+		t.Errorf("February 31st comes on %s", next)
+	}
+}
+
+func TestNewCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* * * * funday",
+		"5-1 * * * *",
+		"*/0 * * * *",
+	} {
+		if _, err := NewCron(expr, ""); err == nil {
+			t.Errorf("NewCron(%q): want an error", expr)
+		}
+	}
+
+	if _, err := NewCron("* * * * *", "Mars/Olympus_Mons"); err == nil {
+		t.Error("NewCron with an unknown timezone: want an error")
+	}
+}
@@ -0,0 +1,231 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job should run next
+type Schedule interface {
+	// Next returns the first time strictly after the given one
+	Next(after time.Time) time.Time
+}
+
+// Daily runs at a time of day in a location, only on some weekdays.
+// No weekdays means every day.
+type Daily struct {
+	Hour     int
+	Minute   int
+	Location *time.Location
+	Weekdays []time.Weekday
+}
+
+// NewDaily parses a "15:04" time, an IANA timezone and weekday names.
+// Empty timezone means UTC.
+func NewDaily(at, timezone string, weekdays []string) (Daily, error) {
+	var d Daily
+	var err error
+
+	d.Hour, d.Minute, err = ParseClock(at)
+	if err != nil {
+		return d, err
+	}
+
+	d.Location, err = LoadLocation(timezone)
+	if err != nil {
+		return d, err
+	}
+
+	d.Weekdays, err = ParseWeekdays(weekdays)
+	if err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+func (d Daily) Next(after time.Time) time.Time {
+	local := after.In(d.Location)
+
+	// A week ahead is always enough to meet one of the weekdays
+	for i := 0; i <= 7; i++ {
+		next := time.Date(local.Year(), local.Month(), local.Day()+i, d.Hour, d.Minute, 0, 0, d.Location)
+		if next.After(after) && d.onWeekday(next.Weekday()) {
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+func (d Daily) onWeekday(day time.Weekday) bool {
+	if len(d.Weekdays) == 0 {
+		return true
+	}
+
+	for _, w := range d.Weekdays {
+		if w == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Job is a running schedule, stop it to cancel future runs
+type Job struct {
+	quit chan struct{}
+}
+
+// Run calls job each time the schedule is due, with the scheduled time.
+// The zero time from Next means the schedule is over.
+func Run(s Schedule, job func(at time.Time)) *Job {
+	j := &Job{quit: make(chan struct{})}
+
+	go func() {
+		for {
+			next := s.Next(time.Now())
+			if next.IsZero() {
+				return
+			}
+
+			timer := time.NewTimer(next.Sub(time.Now()))
+			select {
+			case <-j.quit:
+				timer.Stop()
+				return
+			case <-timer.C:
+				go job(next)
+			}
+		}
+	}()
+
+	return j
+}
+
+func (j *Job) Stop() {
+	close(j.quit)
+}
+
+// ParseClock parses a "15:04" time of day
+func ParseClock(at string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(at), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Invalid time %q, expected HH:MM", at)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("Invalid hour in %q", at)
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("Invalid minute in %q", at)
+	}
+
+	return hour, minute, nil
+}
+
+// LoadLocation loads an IANA timezone, empty means UTC
+func LoadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown timezone %q", timezone)
+	}
+
+	return loc, nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWeekday accepts full or three letter English names, in any case
+func ParseWeekday(name string) (time.Weekday, error) {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	if len(lower) >= 3 {
+		if day, ok := weekdayNames[lower[:3]]; ok && strings.HasPrefix(strings.ToLower(day.String()), lower) {
+			return day, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid weekday %q", name)
+}
+
+func ParseWeekdays(names []string) ([]time.Weekday, error) {
+	var days []time.Weekday
+
+	for _, name := range names {
+		day, err := ParseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// Monthly runs on a day of month at a time of day in a location.
+// Days after the end of a short month run on its last day.
+type Monthly struct {
+	Day      int
+	Hour     int
+	Minute   int
+	Location *time.Location
+}
+
+// NewMonthly parses a day of month, a "15:04" time and an IANA timezone
+func NewMonthly(day int, at, timezone string) (Monthly, error) {
+	m := Monthly{Day: day}
+	var err error
+
+	if day < 1 || day > 31 {
+		return m, fmt.Errorf("Invalid day of month %d", day)
+	}
+
+	m.Hour, m.Minute, err = ParseClock(at)
+	if err != nil {
+		return m, err
+	}
+
+	m.Location, err = LoadLocation(timezone)
+	if err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+func (m Monthly) Next(after time.Time) time.Time {
+	local := after.In(m.Location)
+
+	for i := 0; i <= 1; i++ {
+		first := time.Date(local.Year(), local.Month()+time.Month(i), 1, 0, 0, 0, 0, m.Location)
+
+		day := m.Day
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+
+		next := time.Date(first.Year(), first.Month(), day, m.Hour, m.Minute, 0, 0, m.Location)
+		if next.After(after) {
+			return next
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/dwarvesf/working-on/calendar"
+	"github.com/dwarvesf/working-on/store"
+)
+
+const searchUsage = "Usage: `/working search <words> [from:@user] [tag:#tag] [since:YYYY-MM-DD]`"
+
+// Results per page of `/working search`
+const searchPageSize = 10
+
+// Handle `/working search`, the page of results comes with buttons to the
+// previous and next pages
+func searchItems(items store.ItemStore, args string, page int, location *time.Location) (string, []slack.Attachment, error) {
+	query, err := parseSearch(args, location)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query.Offset = (page - 1) * searchPageSize
+	query.Limit = searchPageSize + 1
+
+	found, err := items.Search(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	more := len(found) > searchPageSize
+	if more {
+		found = found[:searchPageSize]
+	}
+
+	if len(found) == 0 {
+		if page > 1 {
+			return fmt.Sprintf("No more entries for `%s`.", args), nil, nil
+		}
+		return fmt.Sprintf("Nothing found for `%s`.", args), nil, nil
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Entries %d-%d for `%s`:", query.Offset+1, query.Offset+len(found), args)
+	for _, item := range found {
+		fmt.Fprintf(&b, "\n• %s *%s* %s", item.CreatedAt.Format(calendar.Day), item.Name, item.Text)
+		if link := item.Permalink(); link != "" {
+			fmt.Fprintf(&b, " <%s|:link:>", link)
+		}
+	}
+
+	var actions []slack.AttachmentAction
+	if page > 1 {
+		actions = append(actions, searchPageAction("Previous", page-1, args))
+	}
+	if more {
+		actions = append(actions, searchPageAction("Next", page+1, args))
+	}
+	if len(actions) == 0 {
+		return b.String(), nil, nil
+	}
+
+	return b.String(), []slack.Attachment{
+		slack.Attachment{
+			Fallback:   "Use /working search to search again",
+			CallbackID: "search",
+			Actions:    actions,
+		},
+	}, nil
+}
+
+// Button to a page of results, its value is the page and the query
+func searchPageAction(text string, page int, args string) slack.AttachmentAction {
+	return slack.AttachmentAction{Name: "page", Text: text, Type: "button", Value: fmt.Sprintf("%d %s", page, args)}
+}
+
+// Page and query of a page button
+func parseSearchPage(value string) (int, string, error) {
+	parts := strings.SplitN(value, " ", 2)
+	page, err := strconv.Atoi(parts[0])
+	if err != nil || page < 1 || len(parts) < 2 {
+		return 0, "", commandError("Invalid page")
+	}
+
+	return page, parts[1], nil
+}
+
+// Parse `<words> [from:@user] [tag:#tag] [since:YYYY-MM-DD]`, filters may
+// come in any order and the days start in the location
+func parseSearch(args string, location *time.Location) (store.SearchQuery, error) {
+	var query store.SearchQuery
+	var words []string
+
+	for _, field := range strings.Fields(args) {
+		key, value := field, ""
+		if i := strings.Index(field, ":"); i > 0 {
+			key, value = strings.ToLower(field[:i]), field[i+1:]
+		}
+
+		switch key {
+		case "from":
+			// from:bob, from:@bob or from:<@U024BE7LH|bob>
+			if strings.HasPrefix(value, "<@") && strings.HasSuffix(value, ">") {
+				value = strings.SplitN(value[2:len(value)-1], "|", 2)[0]
+			}
+			query.User = strings.TrimPrefix(value, "@")
+		case "tag":
+			query.Tag = value
+		case "since":
+			since, err := time.ParseInLocation(calendar.Day, value, location)
+			if err != nil {
+				return query, commandError(fmt.Sprintf("Invalid date %q, expected YYYY-MM-DD", value))
+			}
+			query.Since = since
+		default:
+			words = append(words, field)
+		}
+	}
+
+	query.Text = strings.Join(words, " ")
+
+	if len(store.SearchWords(query.Text)) == 0 && query.User == "" && query.Tag == "" && query.Since.IsZero() {
+		return query, commandError(searchUsage)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func TestParseSearch(t *testing.T) {
+	saigon, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args  string
+		query store.SearchQuery
+		err   bool
+	}{
+		{"deploy api", store.SearchQuery{Text: "deploy api"}, false},
+		{"deploy from:@bob tag:#classify", store.SearchQuery{Text: "deploy", User: "bob", Tag: "#classify"}, false},
+		{"tag:#classify deploy FROM:bob", store.SearchQuery{Text: "deploy", User: "bob", Tag: "#classify"}, false},
+		{"from:<@U024BE7LH|bob>", store.SearchQuery{User: "U024BE7LH"}, false},
+		{"since:2026-09-01", store.SearchQuery{Since: time.Date(2026, 9, 1, 0, 0, 0, 0, saigon)}, false},
+		{"deploy since:2026-09-01", store.SearchQuery{Text: "deploy", Since: time.Date(2026, 9, 1, 0, 0, 0, 0, saigon)}, false},
+		{"since:yesterday", store.SearchQuery{}, true},
+		{"", store.SearchQuery{}, true},
+		{"-- !!", store.SearchQuery{}, true},
+	}
+
+	for _, test := range tests {
+		query, err := parseSearch(test.args, saigon)
+		if (err != nil) != test.err {
+			t.Errorf("parseSearch(%q): error %v", test.args, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+
+		if query.Text != test.query.Text || query.User != test.query.User || query.Tag != test.query.Tag || !query.Since.Equal(test.query.Since) {
+			t.Errorf("parseSearch(%q) = %+v, want %+v", test.args, query, test.query)
+		}
+	}
+}
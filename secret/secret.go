@@ -0,0 +1,111 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Env of the path of the file of named credentials, a JSON object from
+// name to token which is kept out of the repository
+const CredentialsEnv = "CREDENTIALS_FILE"
+
+// Slack tokens start with xoxb-, xoxp-, xoxa-... and should never be written
+// in a configuration file
+var literal = regexp.MustCompile(`^xox[a-z]-`)
+
+// ErrLiteral tells that a configuration has a token instead of a reference to it
+var ErrLiteral = errors.New("Literal token, use env:NAME, file:/path or credential:name instead")
+
+// Resolve returns the token of a reference:
+//
+//	env:NAME         the env NAME
+//	file:/path       the content of the file, without surrounding spaces
+//	credential:name  the credential name of the CREDENTIALS_FILE file
+//	NAME             the env NAME, as env:NAME
+func Resolve(ref string) (string, error) {
+	if IsLiteral(ref) {
+		return "", ErrLiteral
+	}
+
+	kind, name := "env", ref
+	if i := strings.Index(ref, ":"); i >= 0 {
+		kind, name = ref[:i], ref[i+1:]
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("Missing name in %q", ref)
+	}
+
+	var token string
+	switch kind {
+	case "env":
+		token = os.Getenv(name)
+		if token == "" {
+			return "", fmt.Errorf("Env %s is not set", name)
+		}
+	case "file":
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("Cannot read token file %s", name)
+		}
+
+		token = strings.TrimSpace(string(content))
+		if token == "" {
+			return "", fmt.Errorf("Token file %s is empty", name)
+		}
+	case "credential":
+		var err error
+		token, err = credential(name)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("Unknown token reference %q, expected env:, file: or credential:", kind)
+	}
+
+	return token, nil
+}
+
+// Read a named credential from the file of CREDENTIALS_FILE
+func credential(name string) (string, error) {
+	path := os.Getenv(CredentialsEnv)
+	if path == "" {
+		return "", fmt.Errorf("Credential %s needs %s to be set", name, CredentialsEnv)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Cannot read credentials file %s", path)
+	}
+
+	var credentials map[string]string
+	if err := json.Unmarshal(content, &credentials); err != nil {
+		return "", fmt.Errorf("Cannot parse credentials file %s", path)
+	}
+
+	token := credentials[name]
+	if token == "" {
+		return "", fmt.Errorf("No credential %s in %s", name, path)
+	}
+
+	return token, nil
+}
+
+// IsLiteral tells if s is a Slack token rather than a reference to one
+func IsLiteral(s string) bool {
+	return literal.MatchString(strings.TrimSpace(s))
+}
+
+// Redact hides a token but its kind and last characters, for logs
+func Redact(token string) string {
+	if len(token) <= 12 {
+		return strings.Repeat("*", len(token))
+	}
+
+	return token[:5] + "..." + token[len(token)-4:]
+}
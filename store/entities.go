@@ -0,0 +1,103 @@
+package store
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Entities are what the text of an item refers to, parsed once when the
+// text is set so nothing needs to scan it again
+type Entities struct {
+	// Hashtags in lower case, e.g. "#classify"
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+
+	// Ids of the users and channels the text mentions, e.g. "U024BE7LH", "C024BE91L"
+	Mentions []string `json:"mentions,omitempty" bson:"mentions,omitempty"`
+	Channels []string `json:"channels,omitempty" bson:"channels,omitempty"`
+
+	URLs []string `json:"urls,omitempty" bson:"urls,omitempty"`
+
+	// Issue keys, e.g. "ABC-123" or "#123"
+	Issues []string `json:"issues,omitempty" bson:"issues,omitempty"`
+}
+
+var (
+	// Slack formats references as <@U024BE7LH|bob>, <#C024BE91L|general> and
+	// <https://example.com|label>
+	mentionPattern = regexp.MustCompile(`<@([UW][A-Z0-9]+)(\|[^>]*)?>`)
+	channelPattern = regexp.MustCompile(`<#([CG][A-Z0-9]+)(\|[^>]*)?>`)
+	linkPattern    = regexp.MustCompile(`<(https?://[^|>]+)(\|[^>]*)?>`)
+	urlPattern     = regexp.MustCompile(`https?://[^\s<>]+[^\s<>.,;:!?)'"]`)
+	markupPattern  = regexp.MustCompile(`<[^>]*>`)
+
+	hashtagPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_&/-])(#[\p{L}\p{N}_-]+)`)
+	issuePattern   = regexp.MustCompile(`(^|[^\p{L}\p{N}_-])([A-Z][A-Z0-9]+-[0-9]+|#[0-9]+)\b`)
+	numberPattern  = regexp.MustCompile(`^#[0-9]+$`)
+)
+
+// ParseEntities finds the tags, mentions, channels, URLs and issue keys of text
+func ParseEntities(text string) Entities {
+	var e Entities
+
+	e.Mentions = submatches(mentionPattern, text, 1)
+	e.Channels = submatches(channelPattern, text, 1)
+	e.URLs = submatches(linkPattern, text, 1)
+
+	// Tags and issues are looked for in the text without references and
+	// URLs, so the anchor of a link is not a tag
+	plain := markupPattern.ReplaceAllString(text, " ")
+	e.URLs = unique(append(e.URLs, urlPattern.FindAllString(plain, -1)...))
+	plain = urlPattern.ReplaceAllString(plain, " ")
+
+	e.Tags = Hashtags(plain)
+	e.Issues = submatches(issuePattern, plain, 2)
+
+	return e
+}
+
+// Hashtags returns the hashtags in text in lower case, in order of
+// appearance. Numbers like #123 are issues, not hashtags.
+func Hashtags(text string) []string {
+	var tags []string
+	for _, tag := range submatches(hashtagPattern, markupPattern.ReplaceAllString(text, " "), 2) {
+		if !numberPattern.MatchString(tag) {
+			tags = append(tags, strings.ToLower(tag))
+		}
+	}
+
+	return unique(tags)
+}
+
+// NormalizeTag returns the tag as Entities.Tags has it, tags without # get one
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if !strings.HasPrefix(tag, "#") {
+		tag = "#" + tag
+	}
+
+	return tag
+}
+
+func submatches(re *regexp.Regexp, text string, group int) []string {
+	var list []string
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		list = append(list, match[group])
+	}
+
+	return unique(list)
+}
+
+// Values without repeats, in order of first appearance
+func unique(values []string) []string {
+	var list []string
+	seen := map[string]bool{}
+
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			list = append(list, value)
+		}
+	}
+
+	return list
+}
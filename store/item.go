@@ -0,0 +1,166 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of an entry, depends on which command was used to post it
+const (
+	KindWorking = "working"
+	KindDone    = "done"
+	KindTIL     = "til"
+	KindBlocked = "blocked"
+)
+
+type Item struct {
+	ID        bson.ObjectId `json:"id" bson:"_id"`
+	UserID    string        `json:"user_id" bson:"user_id"`
+	Name      string        `json:"user_name" bson:"user_name"`
+	Text      string        `json:"text" bson:"text"`
+	Kind      string        `json:"kind" bson:"kind"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+
+	// Posts are the messages the bot posted for the item
+	Posts []Post `json:"posts,omitempty" bson:"posts,omitempty"`
+
+	// A done item may close a working item, they link to each other
+	ClosedBy bson.ObjectId `json:"closed_by,omitempty" bson:"closed_by,omitempty"`
+	Closes   bson.ObjectId `json:"closes,omitempty" bson:"closes,omitempty"`
+
+	// Duration from the working item to the done item which closes it
+	Duration time.Duration `json:"duration,omitempty" bson:"duration,omitempty"`
+
+	// What the text refers to, see SetText
+	Entities Entities `json:"entities" bson:"entities"`
+
+	// Message the item was made from, by a reaction of its author
+	Source *Source `json:"source,omitempty" bson:"source,omitempty"`
+
+	// Estimate of a working item and what blocks it, from the entry dialog
+	Estimate time.Duration `json:"estimate,omitempty" bson:"estimate,omitempty"`
+	Blockers string        `json:"blockers,omitempty" bson:"blockers,omitempty"`
+
+	// Who resolved a blocked item and when, nil while it blocks
+	Resolved *Resolution `json:"resolved,omitempty" bson:"resolved,omitempty"`
+}
+
+// Index of the field of Item with the bson name, the id is not a field which
+// can be updated
+func itemField(name string) (int, error) {
+	t := reflect.TypeOf(Item{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := strings.Split(t.Field(i).Tag.Get("bson"), ",")[0]; tag == name && tag != "_id" {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown item field %q", name)
+}
+
+// Copy the fields of from to the item, by their bson names
+func (i *Item) copyFields(from *Item, fields []string) error {
+	to, values := reflect.ValueOf(i).Elem(), reflect.ValueOf(from).Elem()
+	for _, name := range fields {
+		field, err := itemField(name)
+		if err != nil {
+			return err
+		}
+
+		to.Field(field).Set(values.Field(field))
+	}
+
+	return nil
+}
+
+// Resolution of a blocked item, anyone may resolve one
+type Resolution struct {
+	UserID string    `json:"user_id" bson:"user_id"`
+	Name   string    `json:"user_name" bson:"user_name"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// Source is a message of a user which was made an item
+type Source struct {
+	Channel   string `json:"channel" bson:"channel"`
+	Timestamp string `json:"ts" bson:"ts"`
+	Permalink string `json:"permalink,omitempty" bson:"permalink,omitempty"`
+}
+
+// SetText sets the text of the item and the entities parsed from it
+func (i *Item) SetText(text string) {
+	i.Text = text
+	i.Entities = ParseEntities(text)
+}
+
+// Open tells if the item is a working item which is not done yet
+func (i Item) Open() bool {
+	return i.Kind == KindWorking && i.ClosedBy == ""
+}
+
+// Blocking tells if the item is a blocked item which is not resolved yet
+func (i Item) Blocking() bool {
+	return i.Kind == KindBlocked && i.Resolved == nil
+}
+
+// Post is a message posted by the bot to a channel
+type Post struct {
+	// Route is the configured destination, e.g. "#working"
+	Route string `json:"route" bson:"route"`
+
+	// Channel ID and timestamp returned by Slack, together they identify the message
+	Channel   string `json:"channel" bson:"channel"`
+	Timestamp string `json:"ts" bson:"ts"`
+
+	// Thread is the timestamp of the parent message of a reply
+	Thread string `json:"thread_ts,omitempty" bson:"thread_ts,omitempty"`
+
+	// Team and bot user of the token which posted it
+	Team string `json:"team,omitempty" bson:"team,omitempty"`
+	Bot  string `json:"bot,omitempty" bson:"bot,omitempty"`
+
+	Permalink string `json:"permalink,omitempty" bson:"permalink,omitempty"`
+}
+
+// Permalink of the message the item was made from, or of the first message
+// posted for the item, the repost to the working channel
+func (i Item) Permalink() string {
+	if i.Source != nil && i.Source.Permalink != "" {
+		return i.Source.Permalink
+	}
+
+	for _, post := range i.Posts {
+		if post.Permalink != "" {
+			return post.Permalink
+		}
+	}
+
+	return ""
+}
+
+// GuessKind guesses the kind of an item which was stored without one.
+// Old items only have text, so look for the usual hints in it.
+func GuessKind(text string) string {
+	lower := strings.ToLower(strings.TrimSpace(text))
+
+	switch {
+	case strings.Contains(lower, "#til"),
+		strings.HasPrefix(lower, "til "),
+		strings.HasPrefix(lower, "til:"),
+		strings.Contains(lower, "today i learned"):
+		return KindTIL
+	case strings.HasPrefix(lower, "done "),
+		strings.HasPrefix(lower, "done:"),
+		strings.HasPrefix(lower, "finished "),
+		strings.HasPrefix(lower, "fixed "),
+		strings.Contains(lower, ":white_check_mark:"),
+		strings.Contains(lower, ":heavy_check_mark:"):
+		return KindDone
+	}
+
+	return KindWorking
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MemoryStore keeps items in memory, it is meant for tests and local runs
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[bson.ObjectId]Item
+	users map[string]User
+
+	reminders map[bson.ObjectId]Reminder
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items:     map[bson.ObjectId]Item{},
+		users:     map[string]User{},
+		reminders: map[bson.ObjectId]Reminder{},
+	}
+}
+
+func (s *MemoryStore) Insert(item *Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item.ID == "" {
+		item.ID = bson.NewObjectId()
+	}
+
+	s.items[item.ID] = *item
+	return nil
+}
+
+func (s *MemoryStore) Get(id bson.ObjectId) (*Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &item, nil
+}
+
+func (s *MemoryStore) Latest(userID string) (*Item, error) {
+	items := s.filter(func(item Item) bool {
+		return item.UserID == userID
+	}, 0)
+
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &items[len(items)-1], nil
+}
+
+func (s *MemoryStore) GetBySource(channel, timestamp string) (*Item, error) {
+	items := s.filter(func(item Item) bool {
+		return item.Source != nil && item.Source.Channel == channel && item.Source.Timestamp == timestamp
+	}, 1)
+
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &items[0], nil
+}
+
+func (s *MemoryStore) ListByUser(userName string, from, to time.Time) ([]Item, error) {
+	return s.filter(func(item Item) bool {
+		return item.Name == userName && inRange(item.CreatedAt, from, to)
+	}, 0), nil
+}
+
+func (s *MemoryStore) ListByTag(tag string, from, to time.Time) ([]Item, error) {
+	tag = NormalizeTag(tag)
+
+	return s.filter(func(item Item) bool {
+		return contains(item.Entities.Tags, tag) && inRange(item.CreatedAt, from, to)
+	}, 0), nil
+}
+
+func (s *MemoryStore) ListBlocking() ([]Item, error) {
+	return s.filter(func(item Item) bool {
+		return item.Blocking()
+	}, 0), nil
+}
+
+func (s *MemoryStore) Update(item *Item, fields ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.items[item.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if len(fields) == 0 {
+		s.items[item.ID] = *item
+		return nil
+	}
+
+	if err := stored.copyFields(item, fields); err != nil {
+		return err
+	}
+
+	s.items[item.ID] = stored
+	return nil
+}
+
+func (s *MemoryStore) Delete(id bson.ObjectId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.items, id)
+	return nil
+}
+
+func (s *MemoryStore) Search(query SearchQuery) ([]Item, error) {
+	items := s.filter(query.match, 0)
+	sort.Sort(sort.Reverse(byCreatedAt(items)))
+
+	if query.Offset >= len(items) {
+		return nil, nil
+	}
+	items = items[query.Offset:]
+
+	if query.Limit > 0 && len(items) > query.Limit {
+		items = items[:query.Limit]
+	}
+
+	return items, nil
+}
+
+func (s *MemoryStore) GetUser(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		user = User{ID: id}
+	}
+
+	return &user, nil
+}
+
+func (s *MemoryStore) SaveUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *MemoryStore) InsertReminder(reminder *Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if reminder.ID == "" {
+		reminder.ID = bson.NewObjectId()
+	}
+
+	s.reminders[reminder.ID] = *reminder
+	return nil
+}
+
+func (s *MemoryStore) ListReminders() ([]Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reminders []Reminder
+	for _, reminder := range s.reminders {
+		reminders = append(reminders, reminder)
+	}
+
+	sort.Sort(remindersByCreatedAt(reminders))
+	return reminders, nil
+}
+
+func (s *MemoryStore) DeleteReminder(id bson.ObjectId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reminders[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.reminders, id)
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Items matching f, oldest first
+func (s *MemoryStore) filter(f func(item Item) bool, limit int) []Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []Item
+	for _, item := range s.items {
+		if f(item) {
+			items = append(items, item)
+		}
+	}
+
+	sort.Sort(byCreatedAt(items))
+
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	return items
+}
+
+type byCreatedAt []Item
+
+func (a byCreatedAt) Len() int           { return len(a) }
+func (a byCreatedAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCreatedAt) Less(i, j int) bool { return a[i].CreatedAt.Before(a[j].CreatedAt) }
+
+type remindersByCreatedAt []Reminder
+
+func (a remindersByCreatedAt) Len() int           { return len(a) }
+func (a remindersByCreatedAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a remindersByCreatedAt) Less(i, j int) bool { return a[i].CreatedAt.Before(a[j].CreatedAt) }
@@ -0,0 +1,433 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dwarvesf/working-on/db"
+)
+
+const (
+	itemCollection     = "items"
+	userCollection     = "users"
+	reminderCollection = "reminders"
+)
+
+// MongoStore keeps items in the `items` collection of MongoDB
+type MongoStore struct{}
+
+// NewMongoStore connects the process-wide session of the db package
+func NewMongoStore() (*MongoStore, error) {
+	if err := db.Connect(db.OptionsFromEnv()); err != nil {
+		return nil, err
+	}
+
+	s := &MongoStore{}
+	if err := s.ensureIndexes(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Indexes of the queries on entities, sources and kinds
+func (s *MongoStore) ensureIndexes() error {
+	return s.with(func(c *mgo.Collection) error {
+		for _, key := range []string{"entities.tags", "entities.mentions", "entities.channels", "entities.issues"} {
+			if err := c.EnsureIndexKey(key, "created_at"); err != nil {
+				return fmt.Errorf("Cannot create index on %s: %s", key, err)
+			}
+		}
+
+		// Items made from messages by reactions
+		if err := c.EnsureIndexKey("source.channel", "source.ts"); err != nil {
+			return fmt.Errorf("Cannot create index on source: %s", err)
+		}
+
+		// Open blockers of digests
+		if err := c.EnsureIndexKey("kind", "created_at"); err != nil {
+			return fmt.Errorf("Cannot create index on kind: %s", err)
+		}
+
+		// Search, a collection has a single text index
+		if err := c.EnsureIndex(mgo.Index{Key: []string{"$text:text"}}); err != nil {
+			return fmt.Errorf("Cannot create text index: %s", err)
+		}
+
+		return nil
+	})
+}
+
+func (s *MongoStore) Close() error {
+	db.Close()
+	return nil
+}
+
+// Run f with the items collection of a new database context
+func (s *MongoStore) with(f func(c *mgo.Collection) error) error {
+	return s.withCollection(itemCollection, f)
+}
+
+func (s *MongoStore) withCollection(name string, f func(c *mgo.Collection) error) error {
+	ctx, err := db.NewContext()
+	if err != nil {
+		return err
+	}
+
+	defer ctx.Close()
+
+	return f(ctx.C(name))
+}
+
+func (s *MongoStore) Insert(item *Item) error {
+	if item.ID == "" {
+		item.ID = bson.NewObjectId()
+	}
+
+	return s.with(func(c *mgo.Collection) error {
+		return c.Insert(item)
+	})
+}
+
+func (s *MongoStore) Get(id bson.ObjectId) (*Item, error) {
+	var item Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		return c.FindId(id).One(&item)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func (s *MongoStore) Latest(userID string) (*Item, error) {
+	var item Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		return c.Find(bson.M{"user_id": userID}).Sort("-created_at").One(&item)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func (s *MongoStore) GetBySource(channel, timestamp string) (*Item, error) {
+	var item Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		return c.Find(bson.M{"source.channel": channel, "source.ts": timestamp}).One(&item)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func (s *MongoStore) ListByUser(userName string, from, to time.Time) ([]Item, error) {
+	query := createdBetween(from, to)
+	query = append(query, bson.M{"user_name": userName})
+
+	return s.find(bson.M{"$and": query}, 0)
+}
+
+func (s *MongoStore) ListByTag(tag string, from, to time.Time) ([]Item, error) {
+	query := createdBetween(from, to)
+	query = append(query, bson.M{"entities.tags": NormalizeTag(tag)})
+
+	return s.find(bson.M{"$and": query}, 0)
+}
+
+func (s *MongoStore) ListBlocking() ([]Item, error) {
+	return s.find(bson.M{"kind": KindBlocked, "resolved": nil}, 0)
+}
+
+func (s *MongoStore) Update(item *Item, fields ...string) error {
+	if len(fields) == 0 {
+		err := s.with(func(c *mgo.Collection) error {
+			return c.UpdateId(item.ID, item)
+		})
+		if err == mgo.ErrNotFound {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	// Only the fields are set, empty ones are left out of the document and
+	// unset
+	var doc bson.M
+	data, err := bson.Marshal(item)
+	if err == nil {
+		err = bson.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return err
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	for _, name := range fields {
+		if _, err := itemField(name); err != nil {
+			return err
+		}
+
+		if value, ok := doc[name]; ok {
+			set[name] = value
+		} else {
+			unset[name] = ""
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	err = s.with(func(c *mgo.Collection) error {
+		return c.UpdateId(item.ID, update)
+	})
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (s *MongoStore) Delete(id bson.ObjectId) error {
+	err := s.with(func(c *mgo.Collection) error {
+		return c.RemoveId(id)
+	})
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (s *MongoStore) Search(query SearchQuery) ([]Item, error) {
+	filter := []bson.M{}
+
+	// Quoted words must all be in the text, where the text index finds the
+	// forms of the words, `deploy` finds `deployed` but `dep` does not
+	if words := SearchWords(query.Text); len(words) > 0 {
+		phrases := make([]string, len(words))
+		for i, word := range words {
+			phrases[i] = `"` + word + `"`
+		}
+		filter = append(filter, bson.M{"$text": bson.M{"$search": strings.Join(phrases, " ")}})
+	}
+
+	if query.User != "" {
+		name := bson.RegEx{Pattern: "^" + regexp.QuoteMeta(query.User) + "$", Options: "i"}
+		filter = append(filter, bson.M{"$or": []bson.M{{"user_id": query.User}, {"user_name": name}}})
+	}
+
+	if query.Tag != "" {
+		filter = append(filter, bson.M{"entities.tags": NormalizeTag(query.Tag)})
+	}
+
+	if !query.Since.IsZero() {
+		filter = append(filter, bson.M{"created_at": bson.M{"$gte": query.Since}})
+	}
+
+	var find bson.M
+	if len(filter) > 0 {
+		find = bson.M{"$and": filter}
+	}
+
+	var items []Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		q := c.Find(find).Sort("-created_at").Skip(query.Offset)
+		if query.Limit > 0 {
+			q = q.Limit(query.Limit)
+		}
+
+		return q.All(&items)
+	})
+
+	return items, err
+}
+
+func (s *MongoStore) GetUser(id string) (*User, error) {
+	user := User{ID: id}
+
+	err := s.withCollection(userCollection, func(c *mgo.Collection) error {
+		return c.FindId(id).One(&user)
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *MongoStore) SaveUser(user *User) error {
+	return s.withCollection(userCollection, func(c *mgo.Collection) error {
+		_, err := c.UpsertId(user.ID, user)
+		return err
+	})
+}
+
+func (s *MongoStore) InsertReminder(reminder *Reminder) error {
+	if reminder.ID == "" {
+		reminder.ID = bson.NewObjectId()
+	}
+
+	return s.withCollection(reminderCollection, func(c *mgo.Collection) error {
+		return c.Insert(reminder)
+	})
+}
+
+func (s *MongoStore) ListReminders() ([]Reminder, error) {
+	var reminders []Reminder
+
+	err := s.withCollection(reminderCollection, func(c *mgo.Collection) error {
+		return c.Find(nil).Sort("created_at").All(&reminders)
+	})
+
+	return reminders, err
+}
+
+func (s *MongoStore) DeleteReminder(id bson.ObjectId) error {
+	err := s.withCollection(reminderCollection, func(c *mgo.Collection) error {
+		return c.RemoveId(id)
+	})
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// BackfillKind fills kind for items which were created before it was stored
+func (s *MongoStore) BackfillKind() (int, error) {
+	var items []Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		err := c.Find(bson.M{"kind": bson.M{"$exists": false}}).All(&items)
+		if err != nil {
+			return errors.New("Cannot query items without kind")
+		}
+
+		for _, item := range items {
+			err = c.UpdateId(item.ID, bson.M{"$set": bson.M{"kind": GuessKind(item.Text)}})
+			if err != nil {
+				return fmt.Errorf("Cannot update kind of item %s", item.ID.Hex())
+			}
+		}
+
+		return nil
+	})
+
+	return len(items), err
+}
+
+// BackfillEntities parses the entities of items which were stored before them
+func (s *MongoStore) BackfillEntities() (int, error) {
+	var items []Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		err := c.Find(bson.M{"entities": bson.M{"$exists": false}}).All(&items)
+		if err != nil {
+			return errors.New("Cannot query items without entities")
+		}
+
+		for _, item := range items {
+			err = c.UpdateId(item.ID, bson.M{"$set": bson.M{"entities": ParseEntities(item.Text)}})
+			if err != nil {
+				return fmt.Errorf("Cannot update entities of item %s", item.ID.Hex())
+			}
+		}
+
+		return nil
+	})
+
+	return len(items), err
+}
+
+// Each calls f with every item in the collection, oldest first
+func (s *MongoStore) Each(f func(item Item) error) error {
+	return s.with(func(c *mgo.Collection) error {
+		var item Item
+
+		iter := c.Find(nil).Sort("created_at").Iter()
+		for iter.Next(&item) {
+			if err := f(item); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		return iter.Close()
+	})
+}
+
+// EachUser calls f with every user in the users collection
+func (s *MongoStore) EachUser(f func(user User) error) error {
+	return s.withCollection(userCollection, func(c *mgo.Collection) error {
+		var user User
+
+		iter := c.Find(nil).Sort("_id").Iter()
+		for iter.Next(&user) {
+			if err := f(user); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		return iter.Close()
+	})
+}
+
+// Find items matching the query, oldest first
+func (s *MongoStore) find(query bson.M, limit int) ([]Item, error) {
+	var items []Item
+
+	err := s.with(func(c *mgo.Collection) error {
+		q := c.Find(query).Sort("created_at")
+		if limit > 0 {
+			q = q.Limit(limit)
+		}
+
+		return q.All(&items)
+	})
+
+	return items, err
+}
+
+func createdBetween(from, to time.Time) []bson.M {
+	query := []bson.M{}
+
+	if !from.IsZero() {
+		query = append(query, bson.M{"created_at": bson.M{"$gt": from}})
+	}
+
+	if !to.IsZero() {
+		query = append(query, bson.M{"created_at": bson.M{"$lt": to}})
+	}
+
+	return query
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reminder is a message posted to a channel on a schedule
+type Reminder struct {
+	ID      bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Channel string        `json:"channel" bson:"channel"`
+
+	// Text is a template of the message, see render.Data
+	Text string `json:"text" bson:"text"`
+
+	// Crontab expression and IANA timezone, e.g. "30 9 * * mon-fri"
+	Schedule string `json:"schedule" bson:"schedule"`
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+
+	// Days not to post on: weekday names, "2006-01-02" dates and
+	// "2006-01-02..2006-01-05" ranges
+	Skip []string `json:"skip,omitempty" bson:"skip,omitempty"`
+
+	// Name of the env of the bot token, BOT_TOKEN by default
+	Token string `json:"token,omitempty" bson:"token,omitempty"`
+
+	// Who added the reminder with `/working remind add`
+	UserID    string    `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// ReminderStore keeps the reminders added at runtime
+type ReminderStore interface {
+	InsertReminder(reminder *Reminder) error
+	ListReminders() ([]Reminder, error)
+	DeleteReminder(id bson.ObjectId) error
+}
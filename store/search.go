@@ -0,0 +1,75 @@
+package store
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchQuery finds items, newest first. Every part is optional but an
+// empty query finds every item.
+type SearchQuery struct {
+	// Words which must all be in the text, a word matches the words it starts
+	Text string
+
+	// Id or name of the author
+	User string
+
+	Tag   string
+	Since time.Time
+
+	Offset int
+	Limit  int
+}
+
+// SearchWords returns the words of text in lower case, as the search
+// indexes them
+func SearchWords(text string) []string {
+	return unique(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}))
+}
+
+// Tells if the item matches the query, for stores without an index
+func (q SearchQuery) match(item Item) bool {
+	if q.User != "" && item.UserID != q.User && !strings.EqualFold(item.Name, q.User) {
+		return false
+	}
+
+	if q.Tag != "" && !contains(item.Entities.Tags, NormalizeTag(q.Tag)) {
+		return false
+	}
+
+	if !q.Since.IsZero() && item.CreatedAt.Before(q.Since) {
+		return false
+	}
+
+	words := SearchWords(item.Text)
+	for _, word := range SearchWords(q.Text) {
+		if !hasPrefix(words, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasPrefix(words []string, prefix string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
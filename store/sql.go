@@ -0,0 +1,738 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SQL flavour of a database, queries are written with `?` placeholders
+type dialect struct {
+	driver    string
+	timestamp string
+	numbered  bool
+}
+
+var (
+	postgres = dialect{driver: "postgres", timestamp: "TIMESTAMP WITH TIME ZONE", numbered: true}
+	sqlite   = dialect{driver: "sqlite3", timestamp: "TIMESTAMP"}
+)
+
+// Rewrite `?` placeholders to `$n` for databases which need it
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b bytes.Buffer
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Schema migrations, applied in order and recorded in schema_migrations.
+// Never edit a released migration, add a new one instead.
+var migrations = []string{
+	`CREATE TABLE items (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL DEFAULT '',
+		user_name TEXT NOT NULL DEFAULT '',
+		text TEXT NOT NULL DEFAULT '',
+		kind TEXT NOT NULL DEFAULT '',
+		created_at {{timestamp}} NOT NULL
+	)`,
+	`CREATE INDEX items_user_name_created_at ON items (user_name, created_at)`,
+	`CREATE INDEX items_created_at ON items (created_at)`,
+	`ALTER TABLE items ADD COLUMN posts TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX items_user_id_created_at ON items (user_id, created_at)`,
+	`ALTER TABLE items ADD COLUMN closed_by TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN closes TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN duration BIGINT NOT NULL DEFAULT 0`,
+	`CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		user_name TEXT NOT NULL DEFAULT '',
+		no_nudge BOOLEAN NOT NULL DEFAULT FALSE
+	)`,
+	`CREATE TABLE reminders (
+		id TEXT PRIMARY KEY,
+		channel TEXT NOT NULL DEFAULT '',
+		text TEXT NOT NULL DEFAULT '',
+		schedule TEXT NOT NULL DEFAULT '',
+		timezone TEXT NOT NULL DEFAULT '',
+		skip TEXT NOT NULL DEFAULT '',
+		token TEXT NOT NULL DEFAULT '',
+		user_id TEXT NOT NULL DEFAULT '',
+		created_at {{timestamp}} NOT NULL
+	)`,
+	`ALTER TABLE users ADD COLUMN leaves TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN entities TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE item_entities (
+		item_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		value TEXT NOT NULL
+	)`,
+	`CREATE INDEX item_entities_kind_value ON item_entities (kind, value)`,
+	`CREATE INDEX item_entities_item_id ON item_entities (item_id)`,
+	`CREATE TABLE item_words (
+		item_id TEXT NOT NULL,
+		word TEXT NOT NULL
+	)`,
+	`CREATE INDEX item_words_word ON item_words (word)`,
+	`CREATE INDEX item_words_item_id ON item_words (item_id)`,
+	`ALTER TABLE items ADD COLUMN source_channel TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN source_ts TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN source_permalink TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX items_source ON items (source_channel, source_ts)`,
+	`ALTER TABLE items ADD COLUMN estimate BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE items ADD COLUMN blockers TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN resolved_by TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN resolved_name TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN resolved_at {{timestamp}}`,
+	`CREATE INDEX items_kind_created_at ON items (kind, created_at)`,
+}
+
+const itemColumns = "id, user_id, user_name, text, kind, created_at, posts, closed_by, closes, duration, entities, " +
+	"source_channel, source_ts, source_permalink, estimate, blockers, resolved_by, resolved_name, resolved_at"
+
+// SQLStore keeps items in PostgreSQL or SQLite
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// NewSQLStore opens the database of the URL and migrates its schema.
+// Supported URLs are postgres://... and sqlite:///path/to/file.db
+func NewSQLStore(databaseURL string) (*SQLStore, error) {
+	d, dsn, err := parseDatabaseURL(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &SQLStore{db: conn, dialect: d}
+	if err := s.Migrate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func parseDatabaseURL(databaseURL string) (dialect, string, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return dialect{}, "", errors.New("Cannot parse database url")
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return postgres, databaseURL, nil
+	case "sqlite", "sqlite3":
+		path := u.Path
+		if u.Opaque != "" {
+			path = u.Opaque
+		}
+		if u.Host != "" {
+			path = u.Host + path
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		return sqlite, path, nil
+	}
+
+	return dialect{}, "", fmt.Errorf("Unsupported database %q", u.Scheme)
+}
+
+// Migrate applies the migrations which are not applied yet
+func (s *SQLStore) Migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		query := strings.Replace(migrations[i], "{{timestamp}}", s.dialect.timestamp, -1)
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(query); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Cannot apply migration %d: %s", version, err)
+		}
+
+		if _, err := tx.Exec(s.dialect.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		log.Infof("Applied migration %d", version)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) Insert(item *Item) error {
+	if item.ID == "" {
+		item.ID = bson.NewObjectId()
+	}
+
+	values, err := itemValues(item)
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.dialect.rebind(`INSERT INTO items (`+itemColumns+`) VALUES (`+placeholders(len(values))+`)`), values...)
+		if err != nil {
+			return err
+		}
+
+		return s.saveIndex(tx, item)
+	})
+}
+
+func (s *SQLStore) Get(id bson.ObjectId) (*Item, error) {
+	items, err := s.query(`SELECT `+itemColumns+` FROM items WHERE id = ?`, id.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &items[0], nil
+}
+
+func (s *SQLStore) Latest(userID string) (*Item, error) {
+	items, err := s.query(`SELECT `+itemColumns+` FROM items WHERE user_id = ? ORDER BY created_at DESC LIMIT 1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &items[0], nil
+}
+
+func (s *SQLStore) GetBySource(channel, timestamp string) (*Item, error) {
+	items, err := s.query(`SELECT `+itemColumns+` FROM items WHERE source_channel = ? AND source_ts = ? LIMIT 1`, channel, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &items[0], nil
+}
+
+func (s *SQLStore) ListByUser(userName string, from, to time.Time) ([]Item, error) {
+	where, args := sqlCreatedBetween(from, to)
+	args = append([]interface{}{userName}, args...)
+
+	return s.query(`SELECT `+itemColumns+` FROM items WHERE user_name = ?`+where+` ORDER BY created_at`, args...)
+}
+
+func (s *SQLStore) ListByTag(tag string, from, to time.Time) ([]Item, error) {
+	where, args := sqlCreatedBetween(from, to)
+	args = append([]interface{}{entityTag, NormalizeTag(tag)}, args...)
+
+	return s.query(`SELECT `+itemColumns+` FROM items WHERE id IN (SELECT item_id FROM item_entities WHERE kind = ? AND value = ?)`+where+` ORDER BY created_at`, args...)
+}
+
+func (s *SQLStore) ListBlocking() ([]Item, error) {
+	return s.query(`SELECT `+itemColumns+` FROM items WHERE kind = ? AND resolved_at IS NULL ORDER BY created_at`, KindBlocked)
+}
+
+func (s *SQLStore) Update(item *Item, fields ...string) error {
+	values, err := itemValues(item)
+	if err != nil {
+		return err
+	}
+
+	columns := strings.Split(itemColumns, ", ")
+	byColumn := map[string]interface{}{}
+	for i, column := range columns {
+		byColumn[column] = values[i]
+	}
+
+	// Every column but the id without fields, which goes to the WHERE clause
+	updated := columns[1:]
+	reindex := len(fields) == 0
+	if len(fields) > 0 {
+		updated = nil
+		for _, name := range fields {
+			if _, err := itemField(name); err != nil {
+				return err
+			}
+
+			updated = append(updated, fieldColumns(name)...)
+			reindex = reindex || name == "text" || name == "entities"
+		}
+	}
+
+	var set []string
+	var args []interface{}
+	for _, column := range updated {
+		set = append(set, column+" = ?")
+		args = append(args, byColumn[column])
+	}
+	args = append(args, item.ID.Hex())
+
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(s.dialect.rebind(`UPDATE items SET `+strings.Join(set, ", ")+` WHERE id = ?`), args...)
+		if err := checkAffected(res, err); err != nil {
+			return err
+		}
+
+		if !reindex {
+			return nil
+		}
+
+		return s.saveIndex(tx, item)
+	})
+}
+
+// Columns of an item field, by its bson name
+func fieldColumns(name string) []string {
+	switch name {
+	case "source":
+		return []string{"source_channel", "source_ts", "source_permalink"}
+	case "resolved":
+		return []string{"resolved_by", "resolved_name", "resolved_at"}
+	}
+
+	return []string{name}
+}
+
+func (s *SQLStore) Delete(id bson.ObjectId) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(s.dialect.rebind(`DELETE FROM items WHERE id = ?`), id.Hex())
+		if err := checkAffected(res, err); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"item_entities", "item_words"} {
+			if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM `+table+` WHERE item_id = ?`), id.Hex()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Kinds of rows of item_entities
+const (
+	entityTag     = "tag"
+	entityMention = "mention"
+	entityChannel = "channel"
+	entityURL     = "url"
+	entityIssue   = "issue"
+)
+
+// Replace the rows which index the item by tag, mention, ... in
+// item_entities and by word in item_words
+func (s *SQLStore) saveIndex(tx *sql.Tx, item *Item) error {
+	for _, table := range []string{"item_entities", "item_words"} {
+		if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM `+table+` WHERE item_id = ?`), item.ID.Hex()); err != nil {
+			return err
+		}
+	}
+
+	for _, word := range SearchWords(item.Text) {
+		_, err := tx.Exec(s.dialect.rebind(`INSERT INTO item_words (item_id, word) VALUES (?, ?)`), item.ID.Hex(), word)
+		if err != nil {
+			return err
+		}
+	}
+
+	e := item.Entities
+	for kind, values := range map[string][]string{
+		entityTag:     e.Tags,
+		entityMention: e.Mentions,
+		entityChannel: e.Channels,
+		entityURL:     e.URLs,
+		entityIssue:   e.Issues,
+	} {
+		for _, value := range values {
+			_, err := tx.Exec(s.dialect.rebind(`INSERT INTO item_entities (item_id, kind, value) VALUES (?, ?, ?)`), item.ID.Hex(), kind, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// BackfillEntities parses the entities of items which were stored before
+// them, and indexes the words of items which were stored before the search
+func (s *SQLStore) BackfillEntities() (int, error) {
+	items, err := s.query(`SELECT ` + itemColumns + ` FROM items
+		WHERE entities = '' OR (text <> '' AND id NOT IN (SELECT item_id FROM item_words)) ORDER BY created_at`)
+	if err != nil {
+		return 0, errors.New("Cannot query items without entities")
+	}
+
+	for _, item := range items {
+		item.SetText(item.Text)
+		if err := s.Update(&item, "entities"); err != nil {
+			return 0, fmt.Errorf("Cannot update entities of item %s", item.ID.Hex())
+		}
+	}
+
+	return len(items), nil
+}
+
+// Run f in a transaction, committed when f succeeds
+func (s *SQLStore) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Search looks words up in item_words, the index of the words of each item
+func (s *SQLStore) Search(query SearchQuery) ([]Item, error) {
+	q := `SELECT ` + itemColumns + ` FROM items WHERE 1 = 1`
+	var args []interface{}
+
+	for _, word := range SearchWords(query.Text) {
+		q += ` AND id IN (SELECT item_id FROM item_words WHERE word LIKE ? ESCAPE '\')`
+		args = append(args, escapeLike(word)+"%")
+	}
+
+	if query.User != "" {
+		q += ` AND (user_id = ? OR LOWER(user_name) = ?)`
+		args = append(args, query.User, strings.ToLower(query.User))
+	}
+
+	if query.Tag != "" {
+		q += ` AND id IN (SELECT item_id FROM item_entities WHERE kind = ? AND value = ?)`
+		args = append(args, entityTag, NormalizeTag(query.Tag))
+	}
+
+	if !query.Since.IsZero() {
+		q += ` AND created_at >= ?`
+		args = append(args, query.Since.UTC())
+	}
+
+	// SQLite has no OFFSET without LIMIT
+	q += ` ORDER BY created_at DESC`
+	if query.Limit > 0 {
+		q += ` LIMIT ? OFFSET ?`
+		args = append(args, query.Limit, query.Offset)
+	}
+
+	return s.query(q, args...)
+}
+
+func (s *SQLStore) GetUser(id string) (*User, error) {
+	user := User{ID: id}
+	var leaves string
+
+	err := s.db.QueryRow(s.dialect.rebind(`SELECT user_name, no_nudge, leaves FROM users WHERE id = ?`), id).Scan(&user.Name, &user.NoNudge, &leaves)
+	if err == sql.ErrNoRows {
+		return &user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeJSON(leaves, &user.Leaves); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *SQLStore) SaveUser(user *User) error {
+	leaves, err := encodeJSON(user.Leaves)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(s.dialect.rebind(`INSERT INTO users (id, user_name, no_nudge, leaves) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_name = excluded.user_name, no_nudge = excluded.no_nudge, leaves = excluded.leaves`),
+		user.ID, user.Name, user.NoNudge, leaves)
+
+	return err
+}
+
+const reminderColumns = "id, channel, text, schedule, timezone, skip, token, user_id, created_at"
+
+func (s *SQLStore) InsertReminder(reminder *Reminder) error {
+	if reminder.ID == "" {
+		reminder.ID = bson.NewObjectId()
+	}
+
+	skip, err := encodeJSON(reminder.Skip)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(s.dialect.rebind(`INSERT INTO reminders (`+reminderColumns+`) VALUES (`+placeholders(9)+`)`),
+		reminder.ID.Hex(), reminder.Channel, reminder.Text, reminder.Schedule, reminder.Timezone, skip,
+		reminder.Token, reminder.UserID, reminder.CreatedAt.UTC())
+
+	return err
+}
+
+func (s *SQLStore) ListReminders() ([]Reminder, error) {
+	rows, err := s.db.Query(`SELECT ` + reminderColumns + ` FROM reminders ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []Reminder
+	for rows.Next() {
+		var reminder Reminder
+		var id, skip string
+
+		err := rows.Scan(&id, &reminder.Channel, &reminder.Text, &reminder.Schedule, &reminder.Timezone, &skip,
+			&reminder.Token, &reminder.UserID, &reminder.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		reminder.ID = objectID(id)
+		if err := decodeJSON(skip, &reminder.Skip); err != nil {
+			return nil, err
+		}
+
+		reminders = append(reminders, reminder)
+	}
+
+	return reminders, rows.Err()
+}
+
+func (s *SQLStore) DeleteReminder(id bson.ObjectId) error {
+	res, err := s.db.Exec(s.dialect.rebind(`DELETE FROM reminders WHERE id = ?`), id.Hex())
+
+	return checkAffected(res, err)
+}
+
+func (s *SQLStore) query(query string, args ...interface{}) ([]Item, error) {
+	rows, err := s.db.Query(s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		var item Item
+		var id, posts, closedBy, closes, entities string
+		var duration, estimate int64
+		var source Source
+		var resolved Resolution
+		var resolvedAt *time.Time
+
+		err := rows.Scan(&id, &item.UserID, &item.Name, &item.Text, &item.Kind, &item.CreatedAt, &posts, &closedBy, &closes, &duration, &entities,
+			&source.Channel, &source.Timestamp, &source.Permalink, &estimate, &item.Blockers, &resolved.UserID, &resolved.Name, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bson.IsObjectIdHex(id) {
+			return nil, fmt.Errorf("Invalid item id %q", id)
+		}
+		item.ID = bson.ObjectIdHex(id)
+		item.ClosedBy = objectID(closedBy)
+		item.Closes = objectID(closes)
+		item.Duration = time.Duration(duration)
+		item.Estimate = time.Duration(estimate)
+		if source.Channel != "" {
+			item.Source = &source
+		}
+		if resolvedAt != nil {
+			resolved.At = *resolvedAt
+			item.Resolved = &resolved
+		}
+
+		if err := decodeJSON(posts, &item.Posts); err != nil {
+			return nil, err
+		}
+		if err := decodeJSON(entities, &item.Entities); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// Values of itemColumns for the item, lists are stored as JSON
+func itemValues(item *Item) ([]interface{}, error) {
+	posts, err := encodeJSON(item.Posts)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := encodeJSON(item.Entities)
+	if err != nil {
+		return nil, err
+	}
+
+	var source Source
+	if item.Source != nil {
+		source = *item.Source
+	}
+
+	// Items which are not resolved have no time, NULL
+	var resolved Resolution
+	var resolvedAt interface{}
+	if item.Resolved != nil {
+		resolved = *item.Resolved
+		resolvedAt = resolved.At.UTC()
+	}
+
+	return []interface{}{
+		item.ID.Hex(), item.UserID, item.Name, item.Text, item.Kind, item.CreatedAt.UTC(), posts,
+		hex(item.ClosedBy), hex(item.Closes), int64(item.Duration), entities,
+		source.Channel, source.Timestamp, source.Permalink, int64(item.Estimate), item.Blockers,
+		resolved.UserID, resolved.Name, resolvedAt,
+	}, nil
+}
+
+// Optional ids are stored as empty strings when missing
+func hex(id bson.ObjectId) string {
+	if id == "" {
+		return ""
+	}
+
+	return id.Hex()
+}
+
+func objectID(s string) bson.ObjectId {
+	if !bson.IsObjectIdHex(s) {
+		return ""
+	}
+
+	return bson.ObjectIdHex(s)
+}
+
+func encodeJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	if string(b) == "null" {
+		return "", nil
+	}
+
+	return string(b), nil
+}
+
+func decodeJSON(s string, v interface{}) error {
+	if s == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(s), v)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func sqlCreatedBetween(from, to time.Time) (string, []interface{}) {
+	var where string
+	var args []interface{}
+
+	if !from.IsZero() {
+		where += ` AND created_at > ?`
+		args = append(args, from.UTC())
+	}
+
+	if !to.IsZero() {
+		where += ` AND created_at < ?`
+		args = append(args, to.UTC())
+	}
+
+	return where, args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func checkAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrNotFound = errors.New("Item not found")
+
+// ItemStore keeps the items posted by users.
+// Zero from or to time means the range is open on that side.
+// Lists are oldest first, blocking items are the unresolved blocked ones.
+type ItemStore interface {
+	Insert(item *Item) error
+	Get(id bson.ObjectId) (*Item, error)
+	Latest(userID string) (*Item, error)
+	GetBySource(channel, timestamp string) (*Item, error)
+	ListByUser(userName string, from, to time.Time) ([]Item, error)
+	ListByTag(tag string, from, to time.Time) ([]Item, error)
+	ListBlocking() ([]Item, error)
+	// Update saves the fields of the item, by their bson names, or every
+	// field without names. Other fields keep what was saved meanwhile.
+	Update(item *Item, fields ...string) error
+	Delete(id bson.ObjectId) error
+	Search(query SearchQuery) ([]Item, error)
+	Close() error
+}
+
+// New returns the store of the given backend.
+// Without a backend, SQL is used when DATABASE_URL is set, Mongo otherwise.
+func New(backend string) (Store, error) {
+	if backend == "" && os.Getenv("DATABASE_URL") != "" {
+		backend = "sql"
+	}
+
+	switch backend {
+	case "", "mongo":
+		return NewMongoStore()
+	case "sql":
+		return NewSQLStore(os.Getenv("DATABASE_URL"))
+	case "memory":
+		return NewMemoryStore(), nil
+	}
+
+	return nil, fmt.Errorf("Unknown store backend %q", backend)
+}
+
+// Check if t is in the range, both ends are optional
+func inRange(t, from, to time.Time) bool {
+	if !from.IsZero() && !t.After(from) {
+		return false
+	}
+
+	if !to.IsZero() && !t.Before(to) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestSQLiteStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewSQLStore("sqlite://" + filepath.Join(dir, "working-on.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	testStore(t, s)
+
+	// Migrations run once
+	if err := s.Migrate(); err != nil {
+		t.Errorf("Migrate again: %s", err)
+	}
+}
+
+func newItem(userID, name, kind, text string, createdAt time.Time) *Item {
+	item := &Item{UserID: userID, Name: name, Kind: kind, CreatedAt: createdAt}
+	item.SetText(text)
+	return item
+}
+
+// Same checks for every store, items come back as they were saved
+func testStore(t *testing.T, s Store) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	working := newItem("U1", "bob", KindWorking, "Deploy the API of #classify", day.Add(9*time.Hour))
+	working.Posts = []Post{{Route: "#working", Channel: "C1", Timestamp: "1476601200.000002", Permalink: "https://team.slack.com/archives/C1/p1476601200000002"}}
+	working.Estimate = 90 * time.Minute
+	working.Blockers = "Waiting for the keys"
+
+	blocked := newItem("U2", "alice", KindBlocked, "No access to #clipchute staging", day.Add(10*time.Hour))
+
+	til := newItem("U1", "bob", KindTIL, "Go maps are not ordered", day.Add(11*time.Hour))
+	til.Source = &Source{Channel: "C2", Timestamp: "1476608400.000100"}
+
+	done := newItem("U1", "bob", KindDone, "Deployed the API #classify", day.Add(26*time.Hour))
+
+	for _, item := range []*Item{working, blocked, til, done} {
+		if err := s.Insert(item); err != nil {
+			t.Fatalf("Insert %q: %s", item.Text, err)
+		}
+		if item.ID == "" {
+			t.Fatalf("Insert %q: no id", item.Text)
+		}
+	}
+
+	// The done item closes the working one
+	working.ClosedBy, done.Closes, done.Duration = done.ID, working.ID, 17*time.Hour
+	blocked.Resolved = &Resolution{UserID: "U1", Name: "bob", At: day.Add(12 * time.Hour)}
+	for _, item := range []*Item{working, blocked, done} {
+		if err := s.Update(item); err != nil {
+			t.Fatalf("Update %q: %s", item.Text, err)
+		}
+	}
+
+	for _, item := range []*Item{working, blocked, til, done} {
+		got, err := s.Get(item.ID)
+		if err != nil {
+			t.Errorf("Get %q: %s", item.Text, err)
+			continue
+		}
+		checkItems(t, "Get "+item.Text, []Item{*got}, []*Item{item})
+	}
+
+	if _, err := s.Get(bson.NewObjectId()); err != ErrNotFound {
+		t.Errorf("Get of a missing item: got %v, want ErrNotFound", err)
+	}
+
+	lists := []struct {
+		name  string
+		list  func() ([]Item, error)
+		items []*Item
+	}{
+		{"ListByUser", func() ([]Item, error) { return s.ListByUser("bob", time.Time{}, time.Time{}) }, []*Item{working, til, done}},
+		{"ListByUser of a day", func() ([]Item, error) { return s.ListByUser("bob", day, day.AddDate(0, 0, 1)) }, []*Item{working, til}},
+		{"ListByUser from", func() ([]Item, error) { return s.ListByUser("bob", day.Add(11*time.Hour), time.Time{}) }, []*Item{done}},
+		{"ListByTag", func() ([]Item, error) { return s.ListByTag("#Classify", time.Time{}, time.Time{}) }, []*Item{working, done}},
+		{"ListByTag without #", func() ([]Item, error) { return s.ListByTag("clipchute", time.Time{}, time.Time{}) }, []*Item{blocked}},
+		{"ListBlocking of resolved blockers", s.ListBlocking, nil},
+		{"Search", func() ([]Item, error) { return s.Search(SearchQuery{Text: "deploy"}) }, []*Item{done, working}},
+		{"Search by user and tag", func() ([]Item, error) { return s.Search(SearchQuery{Text: "api", User: "BOB", Tag: "#classify"}) }, []*Item{done, working}},
+		{"Search by user id since", func() ([]Item, error) { return s.Search(SearchQuery{User: "U1", Since: day.AddDate(0, 0, 1)}) }, []*Item{done}},
+		{"Search pages", func() ([]Item, error) { return s.Search(SearchQuery{User: "bob", Offset: 1, Limit: 1}) }, []*Item{til}},
+		{"Search without match", func() ([]Item, error) { return s.Search(SearchQuery{Text: "deploy", Tag: "#clipchute"}) }, nil},
+	}
+
+	for _, test := range lists {
+		items, err := test.list()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		checkItems(t, test.name, items, test.items)
+	}
+
+	latest, err := s.Latest("U1")
+	if err != nil || latest.ID != done.ID {
+		t.Errorf("Latest: got %v, %v, want %q", latest, err, done.Text)
+	}
+
+	source, err := s.GetBySource("C2", "1476608400.000100")
+	if err != nil || source.ID != til.ID {
+		t.Errorf("GetBySource: got %v, %v, want %q", source, err, til.Text)
+	}
+
+	blocked.Resolved = nil
+	if err := s.Update(blocked); err != nil {
+		t.Fatalf("Update %q: %s", blocked.Text, err)
+	}
+	blocking, err := s.ListBlocking()
+	if err != nil {
+		t.Errorf("ListBlocking: %s", err)
+	}
+	checkItems(t, "ListBlocking", blocking, []*Item{blocked})
+
+	// Edits change what the item is found by
+	working.SetText("Deploy the API of #clipchute")
+	if err := s.Update(working); err != nil {
+		t.Fatalf("Update %q: %s", working.Text, err)
+	}
+	tagged, err := s.ListByTag("#classify", time.Time{}, time.Time{})
+	if err != nil {
+		t.Errorf("ListByTag after the edit: %s", err)
+	}
+	checkItems(t, "ListByTag after the edit", tagged, []*Item{done})
+
+	// Updates of some fields keep the others saved meanwhile
+	stale := *blocked
+	blocked.Posts = []Post{{Route: "#working", Channel: "C1", Timestamp: "1476604800.000003"}}
+	if err := s.Update(blocked, "posts"); err != nil {
+		t.Fatalf("Update of the posts: %s", err)
+	}
+	stale.Resolved = &Resolution{UserID: "U3", Name: "carol", At: day.Add(13 * time.Hour)}
+	if err := s.Update(&stale, "resolved"); err != nil {
+		t.Fatalf("Update of the resolution: %s", err)
+	}
+	blocked.Resolved = stale.Resolved
+	got, err := s.Get(blocked.ID)
+	if err != nil {
+		t.Fatalf("Get %q: %s", blocked.Text, err)
+	}
+	checkItems(t, "Get after updates of some fields", []Item{*got}, []*Item{blocked})
+
+	blocked.Resolved = nil
+	if err := s.Update(blocked, "resolved"); err != nil {
+		t.Fatalf("Update of the resolution: %s", err)
+	}
+	if got, err := s.Get(blocked.ID); err != nil || got.Resolved != nil {
+		t.Errorf("Get after unsetting the resolution: got %v, %v", got, err)
+	}
+	if err := s.Update(blocked, "unknown"); err == nil {
+		t.Errorf("Update of an unknown field: got no error")
+	}
+
+	if err := s.Delete(til.ID); err != nil {
+		t.Errorf("Delete: %s", err)
+	}
+	if _, err := s.Get(til.ID); err != ErrNotFound {
+		t.Errorf("Get of a deleted item: got %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(til.ID); err != ErrNotFound {
+		t.Errorf("Delete of a deleted item: got %v, want ErrNotFound", err)
+	}
+	if err := s.Update(til); err != ErrNotFound {
+		t.Errorf("Update of a deleted item: got %v, want ErrNotFound", err)
+	}
+
+	testUsers(t, s)
+	testReminders(t, s)
+}
+
+func testUsers(t *testing.T, s Store) {
+	user, err := s.GetUser("U3")
+	if err != nil {
+		t.Fatalf("GetUser of a new user: %s", err)
+	}
+	if !reflect.DeepEqual(*user, User{ID: "U3"}) {
+		t.Errorf("GetUser of a new user: got %+v, want the defaults", *user)
+	}
+
+	user.Name = "carol"
+	user.NoNudge = true
+	user.Leaves = []Leave{{From: "2026-10-20", To: "2026-10-24"}}
+	if err := s.SaveUser(user); err != nil {
+		t.Fatalf("SaveUser: %s", err)
+	}
+
+	got, err := s.GetUser("U3")
+	if err != nil || !reflect.DeepEqual(got, user) {
+		t.Errorf("GetUser: got %+v, %v, want %+v", got, err, user)
+	}
+}
+
+func testReminders(t *testing.T, s Store) {
+	reminders := []*Reminder{
+		{Channel: "#random", Text: "Daily scrum <!here>", Schedule: "30 9 * * mon-fri", Timezone: "Asia/Ho_Chi_Minh", Skip: []string{"2026-12-25"}, UserID: "U1", CreatedAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{Channel: "#general", Text: "Timesheets", Schedule: "0 17 * * fri", UserID: "U2", CreatedAt: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, reminder := range reminders {
+		if err := s.InsertReminder(reminder); err != nil {
+			t.Fatalf("InsertReminder: %s", err)
+		}
+	}
+
+	if err := s.DeleteReminder(reminders[0].ID); err != nil {
+		t.Errorf("DeleteReminder: %s", err)
+	}
+	if err := s.DeleteReminder(reminders[0].ID); err != ErrNotFound {
+		t.Errorf("DeleteReminder of a deleted reminder: got %v, want ErrNotFound", err)
+	}
+
+	got, err := s.ListReminders()
+	if err != nil {
+		t.Fatalf("ListReminders: %s", err)
+	}
+	if len(got) != 1 || got[0].ID != reminders[1].ID || got[0].Text != "Timesheets" || !got[0].CreatedAt.Equal(reminders[1].CreatedAt) {
+		t.Errorf("ListReminders: got %+v, want %+v", got, *reminders[1])
+	}
+}
+
+// Items in the order of want, with the same fields. Times may come back in
+// another location.
+func checkItems(t *testing.T, name string, got []Item, want []*Item) {
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d items, want %d", name, len(got), len(want))
+		return
+	}
+
+	for i := range got {
+		g, w := got[i], *want[i]
+
+		if !g.CreatedAt.Equal(w.CreatedAt) {
+			t.Errorf("%s: item %d created at %s, want %s", name, i, g.CreatedAt, w.CreatedAt)
+		}
+		if g.Resolved != nil && w.Resolved != nil && !g.Resolved.At.Equal(w.Resolved.At) {
+			t.Errorf("%s: item %d resolved at %s, want %s", name, i, g.Resolved.At, w.Resolved.At)
+		}
+
+		g.CreatedAt, w.CreatedAt = time.Time{}, time.Time{}
+		if g.Resolved != nil && w.Resolved != nil {
+			resolved := *g.Resolved
+			resolved.At = w.Resolved.At
+			g.Resolved = &resolved
+		}
+
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: item %d is\n%+v\nwant\n%+v", name, i, g, w)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"time"
+
+	"github.com/dwarvesf/working-on/calendar"
+)
+
+// User keeps the preferences of a Slack user, by Slack user id
+type User struct {
+	ID   string `json:"id" bson:"_id"`
+	Name string `json:"user_name" bson:"user_name"`
+
+	// Do not send direct messages reminding to post
+	NoNudge bool `json:"no_nudge" bson:"no_nudge"`
+
+	// Days off declared with `/working off`
+	Leaves []Leave `json:"leaves,omitempty" bson:"leaves,omitempty"`
+}
+
+// Leave is a range of days off, both ends included, as "2006-01-02" days
+type Leave struct {
+	From string `json:"from" bson:"from"`
+	To   string `json:"to" bson:"to"`
+}
+
+// OnLeave tells if the user is on leave on any day from from until to,
+// excluded, in the location of from
+func (u User) OnLeave(from, to time.Time) bool {
+	first := from.Format(calendar.Day)
+	last := to.Add(-time.Nanosecond).In(from.Location()).Format(calendar.Day)
+
+	for _, leave := range u.Leaves {
+		if leave.From <= last && first <= leave.To {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UserStore keeps the preferences of users.
+// Users who never changed their preferences get the defaults.
+type UserStore interface {
+	GetUser(id string) (*User, error)
+	SaveUser(user *User) error
+}
+
+// Store keeps items, users and reminders
+type Store interface {
+	ItemStore
+	UserStore
+	ReminderStore
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dwarvesf/working-on/bot"
+	"github.com/dwarvesf/working-on/render"
+	"github.com/dwarvesf/working-on/store"
+)
+
+// Working items older than this are not closed by text match
+const openTaskWindow = 30 * 24 * time.Hour
+
+// How similar a done text must be to the text of a working item to close it
+const taskSimilarity = 0.5
+
+// Store a done item, closing the working item it refers to if any.
+// The text may start with the id of the working item, or with "last" for the
+// latest one. Otherwise the open working item with the most similar text is
+// closed, if it is similar enough.
+func addDone(items store.ItemStore, text string, userID string, userName string, configuration Configuration) (*store.Item, *store.Item, error) {
+	task, text, err := findTask(items, userID, userName, text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if task == nil {
+		item, err := addItem(items, text, userID, userName, store.KindDone, configuration)
+		return item, nil, err
+	}
+
+	item := newItem(text, userID, userName, store.KindDone)
+	item.Closes = task.ID
+	item.Duration = item.CreatedAt.Sub(task.CreatedAt)
+
+	if err := saveItem(items, &item, task, configuration); err != nil {
+		return nil, nil, err
+	}
+
+	task.ClosedBy = item.ID
+	if err := items.Update(task, "closed_by"); err != nil {
+		return nil, nil, err
+	}
+
+	return &item, task, nil
+}
+
+// Find the working item a done text refers to, and the text of the done item
+func findTask(items store.ItemStore, userID string, userName string, text string) (*store.Item, string, error) {
+	ref, rest := splitCommand(text)
+
+	if bson.IsObjectIdHex(ref) {
+		task, err := findOwnItem(items, userID, ref)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !task.Open() {
+			return nil, "", commandError(fmt.Sprintf("`%s` is not an open working entry.", ref))
+		}
+
+		if rest == "" {
+			rest = task.Text
+		}
+
+		return task, rest, nil
+	}
+
+	open, err := openTasks(items, userID, userName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ref == "last" {
+		if len(open) == 0 {
+			return nil, "", commandError("You have no open working entry to close.")
+		}
+
+		task := open[len(open)-1]
+		if rest == "" {
+			rest = task.Text
+		}
+
+		return &task, rest, nil
+	}
+
+	var best *store.Item
+	bestScore := 0.0
+	for i := range open {
+		if score := similarity(text, open[i].Text); score >= taskSimilarity && score > bestScore {
+			best, bestScore = &open[i], score
+		}
+	}
+
+	return best, text, nil
+}
+
+// Open working items of the user, oldest first
+func openTasks(items store.ItemStore, userID string, userName string) ([]store.Item, error) {
+	list, err := items.ListByUser(userName, time.Now().Add(-openTaskWindow), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	var open []store.Item
+	for _, item := range list {
+		if item.UserID == userID && item.Open() {
+			open = append(open, item)
+		}
+	}
+
+	return open, nil
+}
+
+// Clear the links between the item and the working or done item it is
+// linked to, before the item is deleted
+func unlinkTask(items store.ItemStore, item *store.Item) error {
+	if item.Closes != "" {
+		task, err := items.Get(item.Closes)
+		if err == nil && task.ClosedBy == item.ID {
+			task.ClosedBy = ""
+			err = items.Update(task, "closed_by")
+		}
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+	}
+
+	if item.ClosedBy != "" {
+		done, err := items.Get(item.ClosedBy)
+		if err == nil && done.Closes == item.ID {
+			done.Closes = ""
+			done.Duration = 0
+			err = items.Update(done, "closes", "duration")
+		}
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Post the item in the threads of the reposts of its parent
+func replyItem(items store.ItemStore, item *store.Item, parent *store.Item, configuration Configuration) {
+	data := itemData(configuration, item)
+
+	for _, post := range parent.Posts {
+		err := withPoster(configuration, post, func(token string, templates *render.Set) error {
+			title, err := templates.Render(item.Kind, data)
+			if err != nil {
+				return err
+			}
+
+			reply, err := bot.Reply(token, post, title)
+			if err != nil {
+				return err
+			}
+
+			item.Posts = append(item.Posts, reply)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Cannot reply to post of item %s in %s: %s", parent.ID.Hex(), post.Route, err)
+		}
+	}
+
+	savePosts(items, item)
+}
+
+// Similarity of two texts by their words, from 0 to 1: the words they share
+// over all their words. Words match the words they start.
+func similarity(a, b string) float64 {
+	wordsA, wordsB := words(a), words(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	common := 0
+	for _, word := range wordsA {
+		for _, other := range wordsB {
+			if sameWord(word, other) {
+				common++
+				break
+			}
+		}
+	}
+
+	// Jaccard index
+	return float64(common) / float64(len(wordsA)+len(wordsB)-common)
+}
+
+// Distinct lowercased words of a text
+func words(text string) []string {
+	var list []string
+	seen := map[string]bool{}
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '#'
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			list = append(list, word)
+		}
+	}
+
+	return list
+}
+
+// Words are the same if one is the other with a suffix, e.g. "fix" and "fixed"
+func sameWord(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	if len(a) < 3 {
+		return a == b
+	}
+
+	return strings.HasPrefix(b, a)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dwarvesf/working-on/store"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		score float64
+	}{
+		{"Deployed the API", "deploy the api", 1},
+		{"deploy", "deploy the api to staging", 0.2},
+		{"deploy api", "deploy the api", 2.0 / 3},
+		{"fix login", "deploy the api", 0},
+		{"#classify docs", "docs of #classify", 2.0 / 3},
+		{"", "deploy", 0},
+	}
+
+	for _, test := range tests {
+		if score := similarity(test.a, test.b); score < test.score-0.001 || score > test.score+0.001 {
+			t.Errorf("similarity(%q, %q) = %.2f, want %.2f", test.a, test.b, score, test.score)
+		}
+	}
+}
+
+func TestFindTask(t *testing.T) {
+	items := store.NewMemoryStore()
+	now := time.Now()
+
+	add := func(userID, name, kind, text string, age time.Duration) *store.Item {
+		item := newItem(text, userID, name, kind)
+		item.CreatedAt = now.Add(-age)
+		if err := items.Insert(&item); err != nil {
+			t.Fatal(err)
+		}
+		return &item
+	}
+
+	docs := add("U1", "bob", store.KindWorking, "Write the onboarding docs", 3*time.Hour)
+	deploy := add("U1", "bob", store.KindWorking, "Deploy the API to staging", 2*time.Hour)
+	old := add("U1", "bob", store.KindWorking, "Migrate the billing database", 40*24*time.Hour)
+	other := add("U2", "alice", store.KindWorking, "Fix the login page", time.Hour)
+	til := add("U1", "bob", store.KindTIL, "Go maps are not ordered", 30*time.Minute)
+
+	tests := []struct {
+		text string
+		task *store.Item
+		rest string
+		err  bool
+	}{
+		{"last", deploy, deploy.Text, false},
+		{"last shipped it", deploy, "shipped it", false},
+		{docs.ID.Hex(), docs, docs.Text, false},
+		{docs.ID.Hex() + " wrote them", docs, "wrote them", false},
+		{"deployed the api to staging", deploy, "deployed the api to staging", false},
+		{"wrote the onboarding docs", docs, "wrote the onboarding docs", false},
+		// One shared word is not enough
+		{"deploy", nil, "deploy", false},
+		// Too old to be closed by its text, but by its id
+		{"migrated the billing database", nil, "migrated the billing database", false},
+		{old.ID.Hex(), old, old.Text, false},
+		{other.ID.Hex(), nil, "", true},
+		{til.ID.Hex(), nil, "", true},
+	}
+
+	for _, test := range tests {
+		task, rest, err := findTask(items, "U1", "bob", test.text)
+		if (err != nil) != test.err {
+			t.Errorf("findTask(%q): error %v", test.text, err)
+			continue
+		}
+
+		if (task == nil) != (test.task == nil) || task != nil && task.ID != test.task.ID || rest != test.rest {
+			t.Errorf("findTask(%q) = %v, %q, want %v, %q", test.text, task, rest, test.task, test.rest)
+		}
+	}
+}
+
+func TestAddDone(t *testing.T) {
+	slack := newFakeSlack(t)
+	defer slack.Close()
+
+	items := store.NewMemoryStore()
+	config := testConfig()
+
+	task, err := addItem(items, "Deploy the API to staging", "U1", "bob", store.KindWorking, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, closed, err := addDone(items, "last shipped it", "U1", "bob", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed == nil || closed.ID != task.ID || done.Closes != task.ID || done.Text != "shipped it" {
+		t.Fatalf("addDone: got %+v closing %+v", done, closed)
+	}
+
+	stored, _ := items.Get(task.ID)
+	if stored.ClosedBy != done.ID || stored.Open() {
+		t.Errorf("task after addDone: %+v", stored)
+	}
+
+	// The done item is a reply in the thread of the task
+	replies := slack.called("chat.postMessage")
+	if len(replies) != 2 || replies[1].Get("thread_ts") != task.Posts[0].Timestamp {
+		t.Errorf("posts: %v", replies)
+	}
+
+	// Nothing is open any more
+	if _, _, err := addDone(items, "last", "U1", "bob", config); err == nil {
+		t.Error("addDone of last without open task: want an error")
+	}
+}